@@ -5,14 +5,19 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/ruandada/aish/internal/base"
 	"github.com/ruandada/aish/internal/plugins"
+	"github.com/ruandada/aish/internal/server"
 )
 
 var (
 	command = flag.String("c", "", "command to execute")
+	mcp     = flag.Bool("mcp", false, "serve the shell as an MCP server over stdio")
+	serve   = flag.String("serve", "", "serve the shell to JSON-RPC clients at stdio or unix:<path>")
 )
 
 func handleError(err error) {
@@ -50,8 +55,21 @@ func main() {
 	}
 
 	var stdin *os.File
+	stdout := os.Stdout
 
 	switch {
+	// commands are evaluated for the clients, which get their output, and stdio may be used by the protocol,
+	// so commands read nothing and write anything else to stderr only
+	case *mcp || *serve != "":
+		file, err := os.Open(os.DevNull)
+		if err != nil {
+			handleError(err)
+			return
+		}
+		defer file.Close()
+		stdin = file
+		stdout = os.Stderr
+
 	// if user use "-c" to execute an inline command, use it as stdin
 	case command != nil && *command != "":
 		file, err := base.ReaderDescriptor(strings.NewReader(*command))
@@ -82,7 +100,7 @@ func main() {
 	}
 
 	shell, err := base.NewShell(
-		base.WithStdIO(stdin, os.Stdout, os.Stderr),
+		base.WithStdIO(stdin, stdout, os.Stderr),
 		base.WithParams(params),
 		base.WithFileName(filename, absoluteFileName),
 		base.WithEnviron(environ),
@@ -92,18 +110,49 @@ func main() {
 		return
 	}
 
+	ai := plugins.NewAIPlugin()
 	if err := shell.Use(
 		plugins.NewPromptPlugin(),
 		plugins.NewPathAutocompletePlugin(),
 		plugins.NewExtensionPlugin(),
-		plugins.NewAIPlugin(),
+		ai,
 	); err != nil {
 		shell.PrintError(os.Stderr, err)
 		os.Exit(1)
 	}
 
+	// the plugins release their resources before the shell exits
+	exit := func(code int) {
+		shell.Close()
+		os.Exit(code)
+	}
+
+	if *mcp {
+		ctx := context.Background()
+		shell.ReadConfig(ctx)
+		if err := server.ServeMCP(ctx, shell, ai, os.Stdin, os.Stdout); err != nil {
+			shell.PrintError(os.Stderr, err)
+			exit(1)
+		}
+		exit(0)
+	}
+
+	if *serve != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		shell.ReadConfig(ctx)
+		if err := server.Serve(ctx, shell, *serve); err != nil {
+			shell.PrintError(os.Stderr, err)
+			stop()
+			exit(1)
+		}
+		stop()
+		exit(0)
+	}
+
 	if err := shell.Start(context.Background()); err != nil {
 		shell.PrintError(os.Stderr, err)
-		os.Exit(1)
+		exit(1)
 	}
+	exit(shell.ExitStatus())
 }
@@ -0,0 +1,107 @@
+#!/usr/bin/env python3
+"""A minimal MCP server over stdio, keeping notes in a JSON file next to it.
+
+It only uses the standard library, and implements the tools and resources of the protocol.
+"""
+
+import json
+import os
+import sys
+
+NOTES_FILE = os.path.join(os.path.dirname(os.path.abspath(__file__)), "notes.json")
+
+TOOLS = [
+    {
+        "name": "add_note",
+        "description": "Add a note",
+        "inputSchema": {
+            "type": "object",
+            "properties": {"text": {"type": "string"}},
+            "required": ["text"],
+        },
+    },
+    {
+        "name": "search_notes",
+        "description": "Search the notes containing a word",
+        "inputSchema": {
+            "type": "object",
+            "properties": {"word": {"type": "string"}},
+            "required": ["word"],
+        },
+    },
+]
+
+RESOURCES = [
+    {"uri": "notes://all", "name": "all notes", "mimeType": "text/plain"},
+]
+
+
+def load_notes():
+    try:
+        with open(NOTES_FILE) as f:
+            return json.load(f)
+    except FileNotFoundError:
+        return []
+
+
+def save_notes(notes):
+    with open(NOTES_FILE, "w") as f:
+        json.dump(notes, f, indent=2)
+
+
+def text_result(text, is_error=False):
+    return {"content": [{"type": "text", "text": text}], "isError": is_error}
+
+
+def call_tool(name, args):
+    notes = load_notes()
+    if name == "add_note":
+        notes.append(args["text"])
+        save_notes(notes)
+        return text_result("note %d added" % len(notes))
+    if name == "search_notes":
+        found = [n for n in notes if args["word"].lower() in n.lower()]
+        return text_result("\n".join(found) or "no notes found")
+    return text_result("unknown tool: %s" % name, True)
+
+
+def handle(method, params):
+    if method == "initialize":
+        return {
+            "protocolVersion": "2024-11-05",
+            "capabilities": {"tools": {}, "resources": {}},
+            "serverInfo": {"name": "notes", "version": "1.0.0"},
+        }
+    if method == "ping":
+        return {}
+    if method == "tools/list":
+        return {"tools": TOOLS}
+    if method == "tools/call":
+        return call_tool(params["name"], params.get("arguments") or {})
+    if method == "resources/list":
+        return {"resources": RESOURCES}
+    if method == "resources/read":
+        text = "\n".join(load_notes())
+        return {"contents": [{"uri": params["uri"], "mimeType": "text/plain", "text": text}]}
+    raise KeyError(method)
+
+
+def main():
+    for line in sys.stdin:
+        if not line.strip():
+            continue
+        msg = json.loads(line)
+        if "id" not in msg:
+            # notifications need no response
+            continue
+
+        resp = {"jsonrpc": "2.0", "id": msg["id"]}
+        try:
+            resp["result"] = handle(msg["method"], msg.get("params") or {})
+        except KeyError as e:
+            resp["error"] = {"code": -32601, "message": "method not found: %s" % e}
+        print(json.dumps(resp), flush=True)
+
+
+if __name__ == "__main__":
+    main()
@@ -5,10 +5,15 @@ Demonstrates how to generate various types of charts using Python
 """
 
 import argparse
+import os
+import re
 import matplotlib.pyplot as plt
 import numpy as np
 from matplotlib import rcParams
 
+# Directory to save the charts in, instead of displaying them
+output_dir = None
+
 # Set font configuration for better display
 rcParams['font.sans-serif'] = ['Arial', 'DejaVu Sans', 'Liberation Sans']
 rcParams['axes.unicode_minus'] = False
@@ -23,6 +28,18 @@ def print_banner():
     """
     print(banner)
 
+def show_chart(title):
+    """Display the chart, or save it and hand it back to AISH so the AI can see it"""
+    if output_dir is None:
+        plt.show()
+        return
+
+    os.makedirs(output_dir, exist_ok=True)
+    path = os.path.join(output_dir, re.sub(r'[^a-zA-Z0-9]+', '_', title).strip('_').lower() + '.png')
+    plt.savefig(path)
+    plt.close()
+    print(f"aish:image={path}")
+
 def create_line_chart(title="Line Chart"):
     """Create line chart"""
     x = np.linspace(0, 10, 100)
@@ -37,7 +54,7 @@ def create_line_chart(title="Line Chart"):
     plt.ylabel('Y Axis', fontsize=12)
     plt.legend()
     plt.grid(True, alpha=0.3)
-    plt.show()
+    show_chart(title)
     print(f"✅ Line chart displayed: {title}")
 
 def create_bar_chart(title="Bar Chart"):
@@ -56,7 +73,7 @@ def create_bar_chart(title="Bar Chart"):
         plt.text(bar.get_x() + bar.get_width()/2, bar.get_height() + 1, 
                 str(value), ha='center', va='bottom', fontweight='bold')
     
-    plt.show()
+    show_chart(title)
     print(f"✅ Bar chart displayed: {title}")
 
 def create_pie_chart(title="Pie Chart"):
@@ -70,7 +87,7 @@ def create_pie_chart(title="Pie Chart"):
             startangle=90, shadow=True)
     plt.title(title, fontsize=16, fontweight='bold')
     plt.axis('equal')
-    plt.show()
+    show_chart(title)
     print(f"✅ Pie chart displayed: {title}")
 
 def create_scatter_plot(title="Scatter Plot"):
@@ -85,7 +102,7 @@ def create_scatter_plot(title="Scatter Plot"):
     plt.xlabel('X Axis', fontsize=12)
     plt.ylabel('Y Axis', fontsize=12)
     plt.grid(True, alpha=0.3)
-    plt.show()
+    show_chart(title)
     print(f"✅ Scatter plot displayed: {title}")
 
 def create_heatmap(title="Heatmap"):
@@ -98,7 +115,7 @@ def create_heatmap(title="Heatmap"):
     plt.title(title, fontsize=16, fontweight='bold')
     plt.xlabel('X Axis', fontsize=12)
     plt.ylabel('Y Axis', fontsize=12)
-    plt.show()
+    show_chart(title)
     print(f"✅ Heatmap displayed: {title}")
 
 def main():
@@ -107,8 +124,12 @@ def main():
     parser.add_argument('chart_type', choices=['line', 'bar', 'pie', 'scatter', 'heatmap', 'all'],
                        help='Chart type')
     parser.add_argument('--title', default='', help='Chart title')
+    parser.add_argument('--save', default=None, metavar='DIR', help='Save the charts to DIR instead of displaying them')
     
     args = parser.parse_args()
+
+    global output_dir
+    output_dir = args.save
     
     print_banner()
     
@@ -0,0 +1,283 @@
+package base
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const AIIgnoreFileName = ".aiignore"
+
+// the prefixes of the lines of .aiignore which are not paths
+const (
+	aiIgnoreCommandPrefix = "command:"
+	aiIgnoreEnvPrefix     = "env:"
+)
+
+// AIIgnore is the policy of the commands, paths and environment variables kept out of the AI context,
+// as it is given by the .aiignore files.
+//
+// A .aiignore file is read like a .gitignore one, each line is a path pattern, except the empty lines,
+// the comments starting with "#", and the lines starting with "command:" or "env:", which give the
+// patterns of the command lines and of the names of environment variables.
+type AIIgnore struct {
+	commands []*regexp.Regexp
+	envs     []*regexp.Regexp
+	paths    []*aiIgnorePathRule
+}
+
+type aiIgnorePathRule struct {
+	re *regexp.Regexp
+	// the directory of the .aiignore file
+	base string
+	// whether the rule is in the .aiignore file of the user, whose rules apply to any directory
+	global   bool
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+type aiIgnoreFile struct {
+	modTime time.Time
+	size    int64
+	policy  *AIIgnore
+}
+
+var (
+	aiIgnoreMu    sync.Mutex
+	aiIgnoreFiles = map[string]*aiIgnoreFile{}
+)
+
+// LoadAIIgnore returns the policy applying to a directory, given by the .aiignore file of the user,
+// and by the .aiignore files of the directory and its parents.
+func LoadAIIgnore(dir string) *AIIgnore {
+	var files []string
+	for dir = filepath.Clean(dir); ; {
+		files = append([]string{filepath.Join(dir, AIIgnoreFileName)}, files...)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	var userFile string
+	if home, err := os.UserHomeDir(); err == nil {
+		userFile = filepath.Join(home, AIIgnoreFileName)
+		files = append([]string{userFile}, files...)
+	}
+
+	policy := &AIIgnore{}
+	seen := map[string]bool{}
+	for _, file := range files {
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+
+		p := readAIIgnoreFile(file, file == userFile)
+		if p == nil {
+			continue
+		}
+		policy.commands = append(policy.commands, p.commands...)
+		policy.envs = append(policy.envs, p.envs...)
+		policy.paths = append(policy.paths, p.paths...)
+	}
+	return policy
+}
+
+// AIIgnored reports whether the content of a file is kept out of the AI context.
+func AIIgnored(path string) bool {
+	path = filepath.Clean(path)
+	return LoadAIIgnore(filepath.Dir(path)).IgnoresPath(path)
+}
+
+// Empty reports whether the policy has no rules.
+func (p *AIIgnore) Empty() bool {
+	return len(p.commands) == 0 && len(p.envs) == 0 && len(p.paths) == 0
+}
+
+// IgnoresCommand reports whether the output of a command is kept out of the AI context. A pattern
+// matches the whole command, or its first words, e.g. "vault read" matches "vault read secret/db".
+func (p *AIIgnore) IgnoresCommand(fields []string) bool {
+	if len(fields) == 0 || len(p.commands) == 0 {
+		return false
+	}
+	fields = append([]string{filepath.Base(fields[0])}, fields[1:]...)
+	for i := range fields {
+		words := strings.Join(fields[:i+1], " ")
+		for _, re := range p.commands {
+			if re.MatchString(words) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IgnoresEnv reports whether the value of an environment variable is kept out of the AI context.
+func (p *AIIgnore) IgnoresEnv(name string) bool {
+	for _, re := range p.envs {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// IgnoresPath reports whether the content of a file is kept out of the AI context, the files
+// in an ignored directory are ignored too. The last rule matching the path wins, as in .gitignore.
+func (p *AIIgnore) IgnoresPath(path string) bool {
+	if len(p.paths) == 0 {
+		return false
+	}
+	path = filepath.Clean(path)
+	isDir := false
+	if stat, err := os.Stat(path); err == nil {
+		isDir = stat.IsDir()
+	}
+
+	// the path and its parents, which are ignored along with their content
+	ignored := false
+	for candidate, dir := path, isDir; ; candidate, dir = filepath.Dir(candidate), true {
+		for _, rule := range p.paths {
+			if rule.matches(candidate, dir) {
+				ignored = !rule.negate
+			}
+		}
+		if ignored || filepath.Dir(candidate) == candidate {
+			return ignored
+		}
+	}
+}
+
+func (r *aiIgnorePathRule) matches(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(r.base, path)
+	inBase := err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	switch {
+	case r.anchored:
+		return inBase && r.re.MatchString(filepath.ToSlash(rel))
+	case inBase || r.global:
+		return r.re.MatchString(filepath.Base(path))
+	}
+	return false
+}
+
+// readAIIgnoreFile returns the policy of a .aiignore file, or nil if there is none. The files are
+// parsed again only when they change.
+func readAIIgnoreFile(file string, global bool) *AIIgnore {
+	stat, err := os.Stat(file)
+	if err != nil || stat.IsDir() {
+		return nil
+	}
+
+	aiIgnoreMu.Lock()
+	defer aiIgnoreMu.Unlock()
+
+	if cached, ok := aiIgnoreFiles[file]; ok && cached.modTime.Equal(stat.ModTime()) && cached.size == stat.Size() {
+		return cached.policy
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	policy := &AIIgnore{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if pattern, ok := strings.CutPrefix(line, aiIgnoreCommandPrefix); ok {
+			if re, err := regexp.Compile("^" + globRegexp(strings.Join(strings.Fields(pattern), " "), false) + "$"); err == nil {
+				policy.commands = append(policy.commands, re)
+			}
+			continue
+		}
+		if pattern, ok := strings.CutPrefix(line, aiIgnoreEnvPrefix); ok {
+			if re, err := regexp.Compile("^" + globRegexp(strings.TrimSpace(pattern), false) + "$"); err == nil {
+				policy.envs = append(policy.envs, re)
+			}
+			continue
+		}
+
+		rule := &aiIgnorePathRule{base: filepath.Dir(file), global: global}
+		if line, rule.negate = strings.CutPrefix(line, "!"); line == "" {
+			continue
+		}
+		if line, rule.dirOnly = strings.CutSuffix(line, "/"); line == "" {
+			continue
+		}
+		// a pattern with a slash, other than a trailing one, is relative to the directory of the file
+		rule.anchored = strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if re, err := regexp.Compile("^" + globRegexp(line, true) + "$"); err == nil {
+			rule.re = re
+			policy.paths = append(policy.paths, rule)
+		}
+	}
+	if scanner.Err() != nil {
+		return nil
+	}
+
+	aiIgnoreFiles[file] = &aiIgnoreFile{modTime: stat.ModTime(), size: stat.Size(), policy: policy}
+	return policy
+}
+
+// globRegexp converts a glob pattern to a regular expression. In a path pattern, "*" and "?" do not
+// match a slash, and "**" matches any number of directories.
+func globRegexp(pattern string, isPath bool) string {
+	many, one := ".*", "."
+	if isPath {
+		many, one = "[^/]*", "[^/]"
+	}
+
+	sb := strings.Builder{}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case isPath && strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case isPath && pattern[i:] == "/**":
+			sb.WriteString("(?:/.*)?")
+			i += 2
+		case isPath && pattern[i:] == "**":
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString(many)
+		case c == '?':
+			sb.WriteString(one)
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
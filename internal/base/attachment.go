@@ -0,0 +1,150 @@
+package base
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// The marker a tool writes on its own line to hand an image back to the model, e.g. "aish:image=./chart.png"
+const ImageMarker = "aish:image="
+
+// files larger than this are refused before decoding
+const maxImageFileSize = 50 << 20
+
+type AIAttachment struct {
+	Name      string `json:"name"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"-"`
+}
+
+func (a *AIAttachment) DataURL() string {
+	return fmt.Sprintf("data:%s;base64,%s", a.MediaType, a.Data)
+}
+
+// LoadImageAttachment reads an image, downscales it when it exceeds the configured dimension or size,
+// and encodes it for sending to the model. The images ignored by .aiignore are refused.
+func LoadImageAttachment(file string) (*AIAttachment, error) {
+	if AIIgnored(file) {
+		return nil, fmt.Errorf("%s: ignored by %s", file, AIIgnoreFileName)
+	}
+	stat, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("%s: is a directory", file)
+	}
+	if stat.Size() > maxImageFileSize {
+		return nil, fmt.Errorf("%s: image too large (%d bytes)", file, stat.Size())
+	}
+
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return NewImageAttachment(filepath.Base(file), raw)
+}
+
+// NewImageAttachment is like LoadImageAttachment, but the image is given as its encoded bytes.
+func NewImageAttachment(name string, raw []byte) (*AIAttachment, error) {
+	img, format, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%s: unsupported image: %w", name, err)
+	}
+
+	maxDimension, _ := GetIntConfig(ConfigMaxImageDimension)
+	maxBytes, _ := GetIntConfig(ConfigMaxImageBytes)
+
+	mediaType := "image/" + format
+	bounds := img.Bounds()
+	if (maxDimension > 0 && max(bounds.Dx(), bounds.Dy()) > maxDimension) || (maxBytes > 0 && len(raw) > maxBytes) || format == "gif" {
+		img = downscaleImage(img, maxDimension)
+
+		buf := bytes.Buffer{}
+		if format == "jpeg" {
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		} else {
+			mediaType = "image/png"
+			err = png.Encode(&buf, img)
+		}
+		if err != nil {
+			return nil, err
+		}
+		raw = buf.Bytes()
+
+		if maxBytes > 0 && len(raw) > maxBytes {
+			return nil, fmt.Errorf("%s: image too large after downscaling (%d bytes), the limit is %d bytes", name, len(raw), maxBytes)
+		}
+	}
+
+	return &AIAttachment{
+		Name:      name,
+		MediaType: mediaType,
+		Data:      base64.StdEncoding.EncodeToString(raw),
+	}, nil
+}
+
+// downscaleImage shrinks the image to fit in a square of the given size by averaging the source pixels.
+func downscaleImage(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if size <= 0 || (w <= size && h <= size) {
+		return src
+	}
+
+	scale := float64(size) / float64(max(w, h))
+	dw, dh := max(int(float64(w)*scale), 1), max(int(float64(h)*scale), 1)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+var pendingAttachments []*AIAttachment
+
+// AddPendingAttachment queues an attachment to be sent with the next question.
+func AddPendingAttachment(attachment *AIAttachment) {
+	pendingAttachments = append(pendingAttachments, attachment)
+}
+
+func GetPendingAttachments() []*AIAttachment {
+	return pendingAttachments
+}
+
+// TakePendingAttachments returns the queued attachments and clears the queue.
+func TakePendingAttachments() []*AIAttachment {
+	attachments := pendingAttachments
+	pendingAttachments = nil
+	return attachments
+}
+
+func ClearPendingAttachments() {
+	pendingAttachments = nil
+}
@@ -0,0 +1,171 @@
+package base
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const AuditFileName = ".aish_audit.jsonl"
+
+// the longest record read from the audit log
+const maxAuditRecordSize = 16 << 20
+
+// AuditRecord is a tool call made by the AI, as it is written in the audit log.
+type AuditRecord struct {
+	Time     time.Time `json:"time"`
+	Session  string    `json:"session"`
+	User     string    `json:"user"`
+	Dir      string    `json:"cwd"`
+	Question string    `json:"question"`
+	Tool     string    `json:"tool"`
+	// the arguments of the tool call as given by the AI, a JSON document if it is valid
+	Arguments json.RawMessage `json:"arguments"`
+	// the code evaluated by the shell, if the tool runs commands
+	Code       string `json:"code,omitempty"`
+	ExitStatus int    `json:"exit_status"`
+	DurationMS int64  `json:"duration_ms"`
+	// how the tool call was approved, if it changes files or follows a suspicious output: auto, approved, rejected, denied or unattended
+	Approval string `json:"approval,omitempty"`
+	// the risk of the tool call: low, medium or high, it is raised after an output looking like instructions to the AI
+	Risk         string `json:"risk,omitempty"`
+	OutputSize   int    `json:"output_size"`
+	OutputSHA256 string `json:"output_sha256"`
+	Error        string `json:"error,omitempty"`
+}
+
+var auditMu sync.Mutex
+
+// AuditLogPath returns the path of the audit log, and false if it is off.
+func AuditLogPath() (string, bool) {
+	path := strings.TrimSpace(GetConfig(ConfigAuditLog))
+	if path == "" || path == AuditLogOff {
+		return "", false
+	}
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		path = filepath.Join(home, path[2:])
+	}
+	return path, true
+}
+
+// AppendAuditRecord appends a record to the audit log, which is rotated once it reaches audit_max_size.
+func AppendAuditRecord(record *AuditRecord) error {
+	path, ok := AuditLogPath()
+	if !ok {
+		return nil
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	if maxSize, ok := GetIntConfig(ConfigAuditMaxSize); ok && maxSize > 0 {
+		if stat, err := os.Stat(path); err == nil && stat.Size() > 0 && stat.Size()+int64(len(line)) > int64(maxSize) {
+			maxFiles, _ := GetIntConfig(ConfigAuditMaxFiles)
+			if err := rotateAuditLog(path, max(maxFiles, 1)); err != nil {
+				return err
+			}
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(line)
+	return err
+}
+
+// rotateAuditLog renames the audit log to path.1, and the older logs to path.2 and so on, up to the given number,
+// which is at least 1 so that no record is removed but the oldest ones.
+func rotateAuditLog(path string, files int) error {
+	_ = os.Remove(rotatedAuditLog(path, files))
+	for i := files - 1; i >= 1; i-- {
+		if err := os.Rename(rotatedAuditLog(path, i), rotatedAuditLog(path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(path, rotatedAuditLog(path, 1))
+}
+
+func rotatedAuditLog(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// ReadAuditRecords returns the records of the audit log and of its rotated logs, the oldest first.
+// The lines which can't be read, e.g. truncated by a crash, are skipped and given to warn.
+func ReadAuditRecords(warn func(error)) ([]*AuditRecord, error) {
+	path, ok := AuditLogPath()
+	if !ok {
+		return nil, fmt.Errorf("the audit log is %s", AuditLogOff)
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	files := []string{path}
+	for i := 1; ; i++ {
+		rotated := rotatedAuditLog(path, i)
+		if _, err := os.Stat(rotated); err != nil {
+			break
+		}
+		files = append([]string{rotated}, files...)
+	}
+
+	var records []*AuditRecord
+	for _, file := range files {
+		r, err := readAuditLog(file, warn)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r...)
+	}
+	return records, nil
+}
+
+func readAuditLog(file string, warn func(error)) ([]*AuditRecord, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []*AuditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxAuditRecordSize)
+	for n := 1; scanner.Scan(); n++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		record := &AuditRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			warn(fmt.Errorf("%s:%d: skipped: %w", file, n, err))
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		// the scanner can't go past a line too long
+		warn(fmt.Errorf("%s: skipped the rest of the file: %w", file, err))
+	}
+	return records, nil
+}
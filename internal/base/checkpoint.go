@@ -0,0 +1,413 @@
+package base
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	CheckpointDirName = ".aish_checkpoints"
+
+	checkpointManifest = "checkpoint.json"
+	// the most checkpoints kept, the oldest ones are removed
+	maxCheckpoints = 50
+	// the files larger than this are not saved, nor the files of a directory beyond the first ones
+	maxCheckpointFileSize  = 10 << 20
+	maxCheckpointDirFiles  = 1000
+	checkpointCreateTrials = 10
+)
+
+// CheckpointFile is a file saved before it was changed.
+type CheckpointFile struct {
+	Path string `json:"path"`
+	// whether the file existed, it is removed on restore otherwise
+	Existed bool        `json:"existed"`
+	Mode    fs.FileMode `json:"mode,omitempty"`
+	// the name of the copy of the file in the checkpoint
+	Copy string `json:"copy,omitempty"`
+	// the file as the turn left it, to tell whether it changed since, nil until the turn ends
+	After *CheckpointFileState `json:"after,omitempty"`
+}
+
+// CheckpointFileState is the content of a file at some time.
+type CheckpointFileState struct {
+	Exists bool   `json:"exists"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+func fileState(path string) (*CheckpointFileState, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &CheckpointFileState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, err
+	}
+	return &CheckpointFileState{Exists: true, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Checkpoint keeps the files changed by the AI while it answered a command line, as they were before.
+type Checkpoint struct {
+	ID        int               `json:"id"`
+	Question  string            `json:"question"`
+	Dir       string            `json:"dir"`
+	CreatedAt time.Time         `json:"created_at"`
+	Files     []*CheckpointFile `json:"files"`
+	// the files which were too large to be saved
+	Skipped []string `json:"skipped,omitempty"`
+	Undone  bool     `json:"undone,omitempty"`
+
+	mu  sync.Mutex
+	dir string
+}
+
+// CheckpointStore keeps the checkpoints of the recent AI turns in a directory, one sub directory each.
+type CheckpointStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+var (
+	checkpointStore     *CheckpointStore
+	checkpointStoreErr  error
+	checkpointStoreOnce sync.Once
+)
+
+// GetCheckpointStore returns the checkpoint store of the current user.
+func GetCheckpointStore() (*CheckpointStore, error) {
+	checkpointStoreOnce.Do(func() {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			checkpointStoreErr = err
+			return
+		}
+		checkpointStore = OpenCheckpointStore(filepath.Join(home, CheckpointDirName))
+	})
+	return checkpointStore, checkpointStoreErr
+}
+
+func OpenCheckpointStore(dir string) *CheckpointStore {
+	return &CheckpointStore{dir: dir}
+}
+
+// New creates an empty checkpoint, numbered after the last one. It is listed once a file is saved in it.
+func (s *CheckpointStore) New(question string, workdir string) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	id := 1
+	if len(ids) > 0 {
+		id = ids[len(ids)-1] + 1
+	}
+
+	// another shell may create the same checkpoint meanwhile
+	for trial := 0; ; trial++ {
+		dir := filepath.Join(s.dir, strconv.Itoa(id))
+		if err := os.Mkdir(dir, 0700); err != nil {
+			if errors.Is(err, fs.ErrExist) && trial < checkpointCreateTrials {
+				id++
+				continue
+			}
+			return nil, err
+		}
+
+		c := &Checkpoint{ID: id, Question: question, Dir: workdir, CreatedAt: time.Now(), Files: []*CheckpointFile{}, dir: dir}
+		s.prune(append(ids, id))
+		return c, nil
+	}
+}
+
+// prune removes the oldest checkpoints beyond the most kept.
+func (s *CheckpointStore) prune(ids []int) {
+	for len(ids) > maxCheckpoints {
+		_ = os.RemoveAll(filepath.Join(s.dir, strconv.Itoa(ids[0])))
+		ids = ids[1:]
+	}
+}
+
+// ids returns the ids of the checkpoints in order.
+func (s *CheckpointStore) ids() ([]int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		if id, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// List returns the checkpoints in order, the last one is the most recent.
+func (s *CheckpointStore) List() ([]*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := make([]*Checkpoint, 0, len(ids))
+	for _, id := range ids {
+		// a checkpoint being created has no manifest yet
+		if c, err := s.get(id); err == nil {
+			checkpoints = append(checkpoints, c)
+		}
+	}
+	return checkpoints, nil
+}
+
+func (s *CheckpointStore) Get(id int) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.get(id)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%d: checkpoint not found", id)
+	}
+	return c, err
+}
+
+func (s *CheckpointStore) get(id int) (*Checkpoint, error) {
+	dir := filepath.Join(s.dir, strconv.Itoa(id))
+	b, err := os.ReadFile(filepath.Join(dir, checkpointManifest))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Checkpoint{dir: dir}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	return c, nil
+}
+
+// Save saves a file, or the files of a directory, as they are before they are changed.
+// A file is saved once, the first time, and a missing file is saved as missing, so that it is removed on restore.
+func (c *Checkpoint) Save(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the checkpoint is saved only if the file is new to it
+	saved := len(c.Files) + len(c.Skipped)
+	stat, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+		if c.has(path) {
+			return nil
+		}
+		c.Files = append(c.Files, &CheckpointFile{Path: path})
+	case err != nil:
+		return err
+	case stat.IsDir():
+		n := 0
+		err := filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return nil
+			}
+			if n++; n > maxCheckpointDirFiles {
+				c.Skipped = append(c.Skipped, path)
+				return filepath.SkipAll
+			}
+			return c.saveFile(file)
+		})
+		if err != nil {
+			return err
+		}
+	case stat.Mode().IsRegular():
+		if err := c.saveFile(path); err != nil {
+			return err
+		}
+	default:
+		// links, devices and such are not saved
+		return nil
+	}
+	if len(c.Files)+len(c.Skipped) == saved {
+		return nil
+	}
+	return c.save()
+}
+
+// Seal records the files as the turn left them, once it ends, so that their later changes are not lost
+// silently on restore. The checkpoint is removed if no file was saved in it.
+func (c *Checkpoint) Seal() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.Files) == 0 && len(c.Skipped) == 0 {
+		return os.RemoveAll(c.dir)
+	}
+	for _, f := range c.Files {
+		state, err := fileState(f.Path)
+		if err != nil {
+			return err
+		}
+		f.After = state
+	}
+	return c.save()
+}
+
+func (c *Checkpoint) saveFile(path string) error {
+	if c.has(path) {
+		return nil
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if stat.Size() > maxCheckpointFileSize {
+		c.Skipped = append(c.Skipped, path)
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	copyName := strconv.Itoa(len(c.Files))
+	if err := os.WriteFile(filepath.Join(c.dir, copyName), data, 0600); err != nil {
+		return err
+	}
+	c.Files = append(c.Files, &CheckpointFile{Path: path, Existed: true, Mode: stat.Mode().Perm(), Copy: copyName})
+	return nil
+}
+
+func (c *Checkpoint) has(path string) bool {
+	for _, f := range c.Files {
+		if f.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Restore restores the files as they were before the changes, and returns the files restored.
+func (c *Checkpoint) Restore() ([]*CheckpointFile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	restored := make([]*CheckpointFile, 0, len(c.Files))
+	var errs []error
+	for _, f := range c.Files {
+		if !f.Existed {
+			if err := os.Remove(f.Path); err == nil {
+				restored = append(restored, f)
+			} else if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(c.dir, f.Copy))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if current, err := os.ReadFile(f.Path); err == nil && string(current) == string(data) {
+			if stat, err := os.Stat(f.Path); err == nil && stat.Mode().Perm() == f.Mode {
+				continue
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.WriteFile(f.Path, data, f.Mode); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// the mode is only given to a created file
+		if err := os.Chmod(f.Path, f.Mode); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		restored = append(restored, f)
+	}
+
+	c.Undone = true
+	if err := c.save(); err != nil {
+		errs = append(errs, err)
+	}
+	return restored, errors.Join(errs...)
+}
+
+// Overlaps returns the files of the checkpoint which were changed again by the more recent turns
+// which are not undone, their changes are lost if the checkpoint is restored.
+// The changes made otherwise are returned by Modified.
+func (c *Checkpoint) Overlaps(checkpoints []*Checkpoint) []string {
+	var paths []string
+	for _, f := range c.Files {
+		for _, other := range checkpoints {
+			if other.ID > c.ID && !other.Undone && other.has(f.Path) {
+				paths = append(paths, f.Path)
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// Modified returns the files of the checkpoint which changed since the turn left them, e.g. edited by hand,
+// their changes are lost if the checkpoint is restored.
+func (c *Checkpoint) Modified() []string {
+	var paths []string
+	for _, f := range c.Files {
+		if f.After == nil {
+			continue
+		}
+		if state, err := fileState(f.Path); err != nil || *state != *f.After {
+			paths = append(paths, f.Path)
+		}
+	}
+	return paths
+}
+
+func (c *Checkpoint) save() error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(c.dir, checkpointManifest)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
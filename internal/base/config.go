@@ -1,18 +1,39 @@
 package base
 
 import (
+	"fmt"
 	"strconv"
+	"sync"
 )
 
 type ConfigName string
 
 const (
-	ConfigOpenAIAPIKey     ConfigName = "openai.api_key"
-	ConfigOpenAIModel      ConfigName = "openai.model"
-	ConfigOpenAIBaseURL    ConfigName = "openai.base_url"
-	ConfigMaxIterations    ConfigName = "max_iter"
-	ConfigMaxHistory       ConfigName = "max_history"
-	ConfigMaxMessageLength ConfigName = "max_message_length"
+	ConfigOpenAIAPIKey         ConfigName = "openai.api_key"
+	ConfigOpenAIModel          ConfigName = "openai.model"
+	ConfigOpenAIBaseURL        ConfigName = "openai.base_url"
+	ConfigMaxIterations        ConfigName = "max_iter"
+	ConfigMaxHistory           ConfigName = "max_history"
+	ConfigMaxMessageLength     ConfigName = "max_message_length"
+	ConfigNarration            ConfigName = "narration"
+	ConfigJSONRetries          ConfigName = "json_retries"
+	ConfigReasoningEffort      ConfigName = "reasoning_effort"
+	ConfigReasoning            ConfigName = "reasoning"
+	ConfigMaxImageDimension    ConfigName = "max_image_dimension"
+	ConfigMaxImageBytes        ConfigName = "max_image_bytes"
+	ConfigMaxMemories          ConfigName = "max_memories"
+	ConfigRender               ConfigName = "render"
+	ConfigClassifier           ConfigName = "classifier"
+	ConfigClassifierConfidence ConfigName = "classifier_confidence"
+	ConfigClassifierModel      ConfigName = "classifier_model"
+	ConfigToolTimeout          ConfigName = "tool_timeout"
+	ConfigToolMaxOutput        ConfigName = "tool_max_output"
+	ConfigFileApproval         ConfigName = "file_approval"
+	ConfigAuditLog             ConfigName = "audit_log"
+	ConfigAuditMaxSize         ConfigName = "audit_max_size"
+	ConfigAuditMaxFiles        ConfigName = "audit_max_files"
+	ConfigRedact               ConfigName = "redact"
+	ConfigInjectionGuard       ConfigName = "injection_guard"
 )
 
 var ConfigKeys = []ConfigName{
@@ -21,19 +42,115 @@ var ConfigKeys = []ConfigName{
 	ConfigOpenAIBaseURL,
 	ConfigMaxIterations,
 	ConfigMaxHistory,
+	ConfigNarration,
+	ConfigJSONRetries,
+	ConfigReasoningEffort,
+	ConfigReasoning,
+	ConfigMaxImageDimension,
+	ConfigMaxImageBytes,
+	ConfigMaxMemories,
+	ConfigRender,
+	ConfigClassifier,
+	ConfigClassifierConfidence,
+	ConfigClassifierModel,
+	ConfigToolTimeout,
+	ConfigToolMaxOutput,
+	ConfigFileApproval,
+	ConfigAuditLog,
+	ConfigAuditMaxSize,
+	ConfigAuditMaxFiles,
+	ConfigRedact,
+	ConfigInjectionGuard,
 }
 
 var defaultConfigValues = map[ConfigName]string{
-	ConfigOpenAIModel:      "gpt-4o-mini",
-	ConfigOpenAIBaseURL:    "https://api.openai.com/v1",
-	ConfigMaxIterations:    "6",
-	ConfigMaxHistory:       "10",
-	ConfigMaxMessageLength: "1000",
+	ConfigOpenAIModel:          "gpt-4o-mini",
+	ConfigOpenAIBaseURL:        "https://api.openai.com/v1",
+	ConfigMaxIterations:        "6",
+	ConfigMaxHistory:           "10",
+	ConfigMaxMessageLength:     "1000",
+	ConfigNarration:            NarrationStderr,
+	ConfigJSONRetries:          "2",
+	ConfigReasoning:            ReasoningHidden,
+	ConfigMaxImageDimension:    "1024",
+	ConfigMaxImageBytes:        "5242880",
+	ConfigMaxMemories:          "5",
+	ConfigRender:               RenderMarkdown,
+	ConfigClassifier:           ClassifierHeuristic,
+	ConfigClassifierConfidence: "70",
+	ConfigToolTimeout:          "120",
+	ConfigToolMaxOutput:        "1048576",
+	ConfigFileApproval:         FileApprovalAsk,
+	ConfigAuditLog:             "~/" + AuditFileName,
+	ConfigAuditMaxSize:         "10485760",
+	ConfigAuditMaxFiles:        "5",
+	ConfigRedact:               RedactOn,
+	ConfigInjectionGuard:       InjectionGuardWarn,
 }
 
-var configValues = map[ConfigName]string{}
+// Where the narration of an AI turn (tool calls and intermediate answers) goes when
+// the output is not a terminal, the final answer is always written to stdout.
+const (
+	NarrationStderr = "stderr"
+	NarrationNone   = "none"
+)
+
+// How the reasoning of reasoning models is displayed, it is never sent back to the model.
+const (
+	ReasoningHidden    = "hidden"
+	ReasoningCollapsed = "collapsed"
+	ReasoningFull      = "full"
+)
+
+// How the answers of the AI are displayed on a terminal, they are always kept as plain Markdown.
+const (
+	RenderMarkdown = "markdown"
+	RenderPlain    = "plain"
+)
+
+// How the input of the auto mode is classified as a command or natural language before it is executed,
+// the uncertain input is asked to the model with "model", or executed as a command otherwise.
+const (
+	ClassifierHeuristic = "heuristic"
+	ClassifierModel     = "model"
+	ClassifierOff       = "off"
+)
+
+// How the changes of the AI to files are approved, the user is asked on a terminal with "ask",
+// and they are refused otherwise.
+const (
+	FileApprovalAsk  = "ask"
+	FileApprovalAuto = "auto"
+	FileApprovalDeny = "deny"
+)
+
+// The audit log of the tool calls is not written with "off".
+const AuditLogOff = "off"
+
+// Whether the secrets in the outputs are hidden from the AI, the user still sees them.
+const (
+	RedactOn  = "on"
+	RedactOff = "off"
+)
+
+// What is done when the output of a tool looks like instructions to the AI, the user is warned and the risk
+// of the next tool call is raised with "warn", and the user is asked to confirm it too with "confirm".
+const (
+	InjectionGuardWarn    = "warn"
+	InjectionGuardConfirm = "confirm"
+	InjectionGuardOff     = "off"
+)
+
+var (
+	// the config is read by the requests of the headless server while a command line sets it
+	configMu     sync.RWMutex
+	configValues = map[ConfigName]string{}
+)
 
 func GetConfig(name ConfigName) string {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
 	if value, ok := configValues[name]; ok {
 		return value
 	}
@@ -54,6 +171,9 @@ func GetIntConfig(name ConfigName) (value int, ok bool) {
 }
 
 func GetAllConfig() map[ConfigName]string {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
 	acc := make(map[ConfigName]string, len(configValues))
 	for k, v := range defaultConfigValues {
 		acc[k] = v
@@ -64,6 +184,21 @@ func GetAllConfig() map[ConfigName]string {
 	return acc
 }
 
+// ValidateConfig checks the value of a setting given to aiset, the values which can't be checked are set as they are.
+func ValidateConfig(name ConfigName, value string) error {
+	switch name {
+	case ConfigAuditMaxFiles:
+		// the audit log is append-only, it can't be rotated away
+		if n, err := strconv.Atoi(value); err != nil || n < 1 {
+			return fmt.Errorf("%s: %s: the number of rotated logs kept must be at least 1", name, value)
+		}
+	}
+	return nil
+}
+
 func SetConfig(name ConfigName, value string) {
+	configMu.Lock()
+	defer configMu.Unlock()
+
 	configValues[name] = value
 }
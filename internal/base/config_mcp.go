@@ -0,0 +1,65 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ruandada/aish/internal/mcp"
+)
+
+var mcpServerNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]+(_[A-Za-z0-9-]+)*$`)
+
+var mcpServers = make(map[string]*mcp.Client)
+
+// AddMCPServer starts an MCP server, and makes its tools available to the AI.
+func AddMCPServer(ctx context.Context, name string, command []string, dir string, environ []string) error {
+	if !mcpServerNamePattern.MatchString(name) || strings.Contains(name, "__") {
+		return fmt.Errorf("%s: invalid server name, use letters, digits, - and _", name)
+	}
+	if _, ok := mcpServers[name]; ok {
+		return fmt.Errorf("%s: server already added", name)
+	}
+
+	client, err := mcp.Start(ctx, name, command, dir, environ)
+	if err != nil {
+		return err
+	}
+	mcpServers[name] = client
+	return nil
+}
+
+func RemoveMCPServer(name string) error {
+	client, ok := mcpServers[name]
+	if !ok {
+		return fmt.Errorf("%s: server not found", name)
+	}
+	delete(mcpServers, name)
+	client.Close()
+	return nil
+}
+
+func ClearMCPServers() {
+	for name := range mcpServers {
+		RemoveMCPServer(name)
+	}
+}
+
+// GetMCPServers returns the added servers sorted by name.
+func GetMCPServers() []*mcp.Client {
+	clients := make([]*mcp.Client, 0, len(mcpServers))
+	for _, client := range mcpServers {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Name() < clients[j].Name()
+	})
+	return clients
+}
+
+func GetMCPServer(name string) (client *mcp.Client, ok bool) {
+	c, ok := mcpServers[name]
+	return c, ok
+}
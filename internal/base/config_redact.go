@@ -0,0 +1,23 @@
+package base
+
+import "regexp"
+
+var definedRedactPatterns []*regexp.Regexp
+
+// AddRedactPattern adds a pattern of the secrets hidden from the AI, besides the built-in ones.
+func AddRedactPattern(pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	definedRedactPatterns = append(definedRedactPatterns, re)
+	return nil
+}
+
+func ClearRedactPatterns() {
+	definedRedactPatterns = nil
+}
+
+func GetRedactPatterns() []*regexp.Regexp {
+	return definedRedactPatterns
+}
@@ -12,6 +12,8 @@ type DefinedTool struct {
 	Name       string
 	Usage      string
 	Entrypoint string
+	// the manifest declaring the tool, if it is loaded by "aitool load"
+	Manifest *ToolManifest
 }
 
 var definedTools = make(map[string]*DefinedTool)
@@ -34,6 +36,29 @@ func AddDefinedTool(usage string, entrypoint string) error {
 	return nil
 }
 
+// AddManifestTool adds a tool declared by a manifest, it is named after the manifest rather than its command.
+func AddManifestTool(manifest *ToolManifest) error {
+	if tool, ok := definedTools[manifest.Name]; ok {
+		return fmt.Errorf("%s: tool %s already defined by %s", manifest.File, manifest.Name, tool.source())
+	}
+
+	definedTools[manifest.Name] = &DefinedTool{
+		Usage:      manifest.Description,
+		Name:       manifest.Name,
+		Entrypoint: manifest.Command,
+		Manifest:   manifest,
+	}
+	return nil
+}
+
+// source returns the file defining the tool.
+func (t *DefinedTool) source() string {
+	if t.Manifest != nil {
+		return t.Manifest.File
+	}
+	return t.Entrypoint
+}
+
 func ClearDefinedTools() {
 	definedTools = make(map[string]*DefinedTool)
 }
@@ -2,8 +2,14 @@ package base
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/acarl005/stripansi"
 	"github.com/openai/openai-go"
@@ -19,14 +25,68 @@ type CommandExecution struct {
 	incomplete  bool
 	interactive bool
 	terminated  bool
+	exitStatus  interp.ExitStatus
 
 	buf *strings.Builder
+	// the command line as it is given, empty for the code evaluated by plugins
+	input []byte
+	// whether the output is kept out of the buffer, as .aiignore requires
+	withheld bool
+	// whether the code being evaluated is under limits, see Shell.EvalWithLimits
+	limited bool
+	// limits the output copied from the terminal of the commands, which is shared by the copying goroutines
+	limiter atomic.Pointer[outputLimiter]
 
 	qa []*AIExecution
+
+	// cancels the step of the execution which is running and can be interrupted alone
+	interruptMu sync.Mutex
+	interrupt   context.CancelCauseFunc
+}
+
+// ErrInterrupted is reported by a step of an execution interrupted by the user, e.g. the generation of an answer.
+var ErrInterrupted = errors.New("interrupted by user")
+
+// LimitError is reported by a command line stopped because it exceeded a limit of its execution, e.g. one run by the AI.
+type LimitError struct {
+	// the timeout which is reached, or zero
+	Timeout time.Duration
+	// the number of bytes the output is truncated at, or zero
+	MaxOutput int64
+}
+
+func (e *LimitError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("timed out after %s", e.Timeout)
+	}
+	return fmt.Sprintf("output truncated at %d bytes", e.MaxOutput)
 }
 
 type commandExecutionKey struct{}
 
+type executionListenerKey struct{}
+
+type ExecutionEventType string
+
+const (
+	// a piece of the answer generated by the AI
+	ExecutionEventToken ExecutionEventType = "token"
+	// a piece of the reasoning of the AI
+	ExecutionEventReasoning ExecutionEventType = "reasoning"
+	// a tool used by the AI
+	ExecutionEventToolCall ExecutionEventType = "tool_call"
+)
+
+type ExecutionEvent struct {
+	Type ExecutionEventType `json:"type"`
+	Data string             `json:"data"`
+}
+
+// WithExecutionListener returns a context, in which the command executions report their events to the listener.
+func WithExecutionListener(ctx context.Context, listener func(event ExecutionEvent)) context.Context {
+	return context.WithValue(ctx, executionListenerKey{}, listener)
+}
+
 func GetCommandExecution(ctx context.Context) (*CommandExecution, bool) {
 	ce, ok := ctx.Value(commandExecutionKey{}).(*CommandExecution)
 	if !ok || ce == nil {
@@ -53,10 +113,24 @@ func (c *CommandExecution) AppendQA(qa *AIExecution) {
 	c.qa = append(c.qa, qa)
 }
 
+// RemoveQA removes the AI execution from the command execution, e.g. when it is continued by a later command.
+func (c *CommandExecution) RemoveQA(qa *AIExecution) {
+	c.qa = slices.DeleteFunc(c.qa, func(e *AIExecution) bool {
+		return e == qa
+	})
+}
+
 func (c *CommandExecution) QA() []*AIExecution {
 	return c.qa
 }
 
+// Emit reports an event to the listener of the execution if there is one.
+func (c *CommandExecution) Emit(event ExecutionEvent) {
+	if listener, ok := c.parentCtx.Value(executionListenerKey{}).(func(event ExecutionEvent)); ok {
+		listener(event)
+	}
+}
+
 func (c *CommandExecution) Context() context.Context {
 	return c.ctx
 }
@@ -65,10 +139,54 @@ func (c *CommandExecution) Cancel() {
 	c.cancel()
 }
 
+// Interruptible returns the context of a step of the execution, which the user can interrupt without
+// cancelling the whole execution, e.g. the generation of an answer. The returned function ends the step.
+func (c *CommandExecution) Interruptible() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(c.ctx)
+
+	c.interruptMu.Lock()
+	c.interrupt = cancel
+	c.interruptMu.Unlock()
+
+	return ctx, func() {
+		c.interruptMu.Lock()
+		c.interrupt = nil
+		c.interruptMu.Unlock()
+		cancel(nil)
+	}
+}
+
+// Interrupt interrupts the running interruptible step, it returns false when there is none.
+func (c *CommandExecution) Interrupt() bool {
+	c.interruptMu.Lock()
+	defer c.interruptMu.Unlock()
+
+	if c.interrupt == nil {
+		return false
+	}
+	c.interrupt(ErrInterrupted)
+	c.interrupt = nil
+	return true
+}
+
 func (c *CommandExecution) Buffer() *strings.Builder {
 	return c.buf
 }
 
+// Input returns the command line being executed, as it is given by the user.
+func (c *CommandExecution) Input() []byte {
+	return c.input
+}
+
+// Withheld reports whether the output is kept out of the buffer, and so out of the AI context.
+func (c *CommandExecution) Withheld() bool {
+	return c.withheld
+}
+
+func (c *CommandExecution) SetWithheld(withheld bool) {
+	c.withheld = withheld
+}
+
 func (c *CommandExecution) AnswerText() string {
 	return strings.TrimSpace(stripansi.Strip(c.Buffer().String()))
 }
@@ -89,16 +207,28 @@ func (c *CommandExecution) Incomplete() bool {
 	return c.incomplete
 }
 
+// ExitStatus returns the exit status of the command line, once it is terminated.
+func (c *CommandExecution) ExitStatus() int {
+	return int(c.exitStatus)
+}
+
 type AIAssistantAnswer struct {
-	Text     string                                `json:"text"`
-	ToolCall *openai.ChatCompletionMessageToolCall `json:"tool_call"`
+	Text        string                                `json:"text"`
+	ToolCall    *openai.ChatCompletionMessageToolCall `json:"tool_call"`
+	Attachments []*AIAttachment                       `json:"attachments,omitempty"`
+	// the execution of the sub task, when the tool call delegated one
+	Delegated *AIExecution `json:"delegated,omitempty"`
 }
 
 type AIExecution struct {
 	parent        *AIExecution
-	UnderToolCall *openai.ChatCompletionMessageToolCall
-	Question      string
-	Answers       []AIAssistantAnswer
+	delegated     bool
+	UnderToolCall *openai.ChatCompletionMessageToolCall `json:"under_tool_call,omitempty"`
+	Question      string                                `json:"question"`
+	Attachments   []*AIAttachment                       `json:"attachments,omitempty"`
+	Answers       []AIAssistantAnswer                   `json:"answers"`
+	// the tool whose output in the answers looked like instructions to AI, until the user approves a tool call
+	SuspiciousTool string `json:"suspicious_tool,omitempty"`
 }
 
 func (e *AIExecution) IsRoot() bool {
@@ -115,6 +245,34 @@ func (e *AIExecution) Trace() []*AIExecution {
 	return trace
 }
 
+// Delegate creates the execution of a sub task, which is answered in a fresh context,
+// the answers within it are not seen by this execution.
+func (e *AIExecution) Delegate(task string) *AIExecution {
+	return &AIExecution{
+		parent:    e,
+		delegated: true,
+		Question:  task,
+		Answers:   make([]AIAssistantAnswer, 0),
+	}
+}
+
+func (e *AIExecution) IsDelegated() bool {
+	return e.delegated
+}
+
+// Scope returns the executions which see the answers of this one, like Trace, but
+// stops at the nearest delegated execution.
+func (e *AIExecution) Scope() []*AIExecution {
+	scope := []*AIExecution{}
+	for cursor := e; cursor != nil; cursor = cursor.parent {
+		scope = append(scope, cursor)
+		if cursor.delegated {
+			break
+		}
+	}
+	return scope
+}
+
 type SubCommandExecution struct {
 	mode        ShellMode
 	ce          *CommandExecution
@@ -146,6 +304,10 @@ func (ce *CommandExecution) NewSubCommandExecution(fields []string, hc *interp.H
 	}
 }
 
+func (c *SubCommandExecution) Context() context.Context {
+	return c.ce.Context()
+}
+
 func (c *SubCommandExecution) Fields() []string {
 	return c.fields
 }
@@ -165,6 +327,11 @@ func (c *SubCommandExecution) QA() *AIExecution {
 	return c.qa
 }
 
+// SetQA makes the execution answer as a part of the given AI execution, e.g. to continue it.
+func (c *SubCommandExecution) SetQA(qa *AIExecution) {
+	c.qa = qa
+}
+
 func (c *SubCommandExecution) Mode() ShellMode {
 	return c.mode
 }
@@ -193,6 +360,16 @@ func (c *SubCommandExecution) Stderr() io.Writer {
 	return c.hc.Stderr
 }
 
+// Used to write content that only visible to user
+func (c *SubCommandExecution) UserStdout() io.Writer {
+	return c.ce.shell.uncaptured(c.Stdout())
+}
+
+// Used to write error content that only visible to user
+func (c *SubCommandExecution) UserStderr() io.Writer {
+	return c.ce.shell.uncaptured(c.Stderr())
+}
+
 func (c *SubCommandExecution) Stdin() io.Reader {
 	return c.hc.Stdin
 }
@@ -211,8 +388,14 @@ func (c *SubCommandExecution) ColorSupported() bool {
 }
 
 func (c *SubCommandExecution) Inherit(parent *SubCommandExecution) {
+	c.InheritWithQA(parent, parent.qa)
+}
+
+// InheritWithQA is like Inherit, but the execution answers as a part of the given AI execution
+// instead of the parent's, e.g. a command run for a delegated sub task.
+func (c *SubCommandExecution) InheritWithQA(parent *SubCommandExecution, qa *AIExecution) {
 	c.parent = parent
-	c.qa.parent = parent.qa
+	c.qa.parent = qa
 
 	shell := c.ce.shell
 
@@ -0,0 +1,39 @@
+package base
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// ErrLocked is returned by TryLockFile, when the file is locked by another shell.
+var ErrLocked = errors.New("locked by another shell")
+
+// LockFile takes an exclusive advisory lock on a file next to the given one, which serializes the updates
+// of the file by several shells. The returned function releases the lock.
+func LockFile(file string) (func(), error) {
+	return lockFile(file, syscall.LOCK_EX)
+}
+
+// TryLockFile is like LockFile, but it fails with ErrLocked rather than waiting for the lock.
+func TryLockFile(file string) (func(), error) {
+	return lockFile(file, syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+func lockFile(file string, how int) (func(), error) {
+	f, err := os.OpenFile(file+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
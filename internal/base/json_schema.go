@@ -0,0 +1,288 @@
+package base
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONSchema is a JSON Schema document decoded into generic values.
+// Only the keywords commonly used to describe structured data are validated.
+type JSONSchema map[string]any
+
+// the keywords constraining the values which Validate doesn't check
+var unsupportedJSONSchemaKeywords = []string{
+	"$ref", "$dynamicRef", "format", "multipleOf", "uniqueItems", "contains", "minContains", "maxContains", "prefixItems",
+	"not", "if", "then", "else", "patternProperties", "propertyNames", "minProperties", "maxProperties",
+	"dependencies", "dependentRequired", "dependentSchemas", "unevaluatedProperties", "unevaluatedItems",
+}
+
+func LoadJSONSchema(file string) (JSONSchema, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := JSONSchema{}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		return nil, fmt.Errorf("%s: invalid JSON schema: %w", file, err)
+	}
+	return schema, nil
+}
+
+// Validate checks the decoded JSON value against the schema, and returns all violations found.
+func (s JSONSchema) Validate(value any) error {
+	errs := validateJSONSchema(map[string]any(s), value, "$", nil)
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+// CheckKeywords returns an error if the schema uses keywords Validate doesn't check, or an invalid pattern,
+// the values would be accepted without the constraints they describe.
+func (s JSONSchema) CheckKeywords() error {
+	return checkJSONSchemaKeywords(map[string]any(s), "$")
+}
+
+func checkJSONSchemaKeywords(schema map[string]any, path string) error {
+	for _, keyword := range unsupportedJSONSchemaKeywords {
+		if _, ok := schema[keyword]; ok {
+			return fmt.Errorf("%s: the JSON schema keyword %q is not supported", path, keyword)
+		}
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("%s: invalid pattern: %w", path, err)
+		}
+	}
+	if _, ok := schema["items"].([]any); ok {
+		return fmt.Errorf("%s: the JSON schema keyword \"items\" must be a schema, not an array", path)
+	}
+
+	subSchemas := map[string]any{}
+	if properties, ok := schema["properties"].(map[string]any); ok {
+		for name, property := range properties {
+			subSchemas[path+"."+name] = property
+		}
+	}
+	for _, keyword := range []string{"items", "additionalProperties"} {
+		subSchemas[path+"."+keyword] = schema[keyword]
+	}
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		list, _ := schema[keyword].([]any)
+		for i, sub := range list {
+			subSchemas[fmt.Sprintf("%s.%s[%d]", path, keyword, i)] = sub
+		}
+	}
+
+	paths := make([]string, 0, len(subSchemas))
+	for p := range subSchemas {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if sub, ok := subSchemas[p].(map[string]any); ok {
+			if err := checkJSONSchemaKeywords(sub, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateJSONSchema(schema map[string]any, value any, path string, errs []string) []string {
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+
+	if t, ok := schema["type"]; ok {
+		types := []string{}
+		switch t := t.(type) {
+		case string:
+			types = append(types, t)
+		case []any:
+			for _, v := range t {
+				if s, ok := v.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+		if len(types) > 0 && !matchesJSONType(types, value) {
+			fail("expected %s, got %s", strings.Join(types, " or "), jsonTypeOf(value))
+			return errs
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, v := range enum {
+			if jsonEqual(v, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			b, _ := json.Marshal(enum)
+			fail("must be one of %s", b)
+		}
+	}
+
+	if c, ok := schema["const"]; ok && !jsonEqual(c, value) {
+		b, _ := json.Marshal(c)
+		fail("must be %s", b)
+	}
+
+	switch v := value.(type) {
+	case string:
+		n := float64(utf8.RuneCountInString(v))
+		if min, ok := schema["minLength"].(float64); ok && n < min {
+			fail("must be at least %v characters long", min)
+		}
+		if max, ok := schema["maxLength"].(float64); ok && n > max {
+			fail("must be at most %v characters long", max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err != nil {
+				fail("invalid pattern %q in the schema: %v", pattern, err)
+			} else if !re.MatchString(v) {
+				fail("must match pattern %q", pattern)
+			}
+		}
+
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && v < min {
+			fail("must be >= %v", min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && v > max {
+			fail("must be <= %v", max)
+		}
+		if min, ok := schema["exclusiveMinimum"].(float64); ok && v <= min {
+			fail("must be > %v", min)
+		}
+		if max, ok := schema["exclusiveMaximum"].(float64); ok && v >= max {
+			fail("must be < %v", max)
+		}
+
+	case []any:
+		n := float64(len(v))
+		if min, ok := schema["minItems"].(float64); ok && n < min {
+			fail("must have at least %v items", min)
+		}
+		if max, ok := schema["maxItems"].(float64); ok && n > max {
+			fail("must have at most %v items", max)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				errs = validateJSONSchema(items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+
+	case map[string]any:
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if name, ok := name.(string); ok {
+					if _, ok := v[name]; !ok {
+						fail("missing required property %q", name)
+					}
+				}
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]any)
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			childPath := path + "." + k
+			if propSchema, ok := properties[k].(map[string]any); ok {
+				errs = validateJSONSchema(propSchema, v[k], childPath, errs)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					fail("unexpected property %q", k)
+				}
+			case map[string]any:
+				errs = validateJSONSchema(additional, v[k], childPath, errs)
+			}
+		}
+	}
+
+	if allOf, ok := schema["allOf"].([]any); ok {
+		for _, sub := range allOf {
+			if sub, ok := sub.(map[string]any); ok {
+				errs = validateJSONSchema(sub, value, path, errs)
+			}
+		}
+	}
+
+	if anyOf, ok := schema["anyOf"].([]any); ok && countJSONSchemaMatches(anyOf, value, path) == 0 {
+		fail("must match at least one schema in anyOf")
+	}
+
+	if oneOf, ok := schema["oneOf"].([]any); ok && countJSONSchemaMatches(oneOf, value, path) != 1 {
+		fail("must match exactly one schema in oneOf")
+	}
+
+	return errs
+}
+
+func countJSONSchemaMatches(schemas []any, value any, path string) int {
+	n := 0
+	for _, sub := range schemas {
+		if sub, ok := sub.(map[string]any); ok && len(validateJSONSchema(sub, value, path, nil)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func matchesJSONType(types []string, value any) bool {
+	actual := jsonTypeOf(value)
+	for _, t := range types {
+		if t == actual {
+			return true
+		}
+		if t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonTypeOf(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func jsonEqual(a any, b any) bool {
+	x, errX := json.Marshal(a)
+	y, errY := json.Marshal(b)
+	return errX == nil && errY == nil && string(x) == string(y)
+}
@@ -0,0 +1,302 @@
+package base
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const MemoryFileName = ".aish_memory.json"
+
+type MemoryScope string
+
+const (
+	MemoryScopeGlobal    MemoryScope = "global"
+	MemoryScopeWorkspace MemoryScope = "workspace"
+)
+
+type Memory struct {
+	ID        string      `json:"id"`
+	Content   string      `json:"content"`
+	Scope     MemoryScope `json:"scope"`
+	Workspace string      `json:"workspace,omitempty"`
+	Tags      []string    `json:"tags,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// VisibleIn reports whether the memory applies to the given working directory.
+func (m *Memory) VisibleIn(dir string) bool {
+	if m.Scope != MemoryScopeWorkspace {
+		return true
+	}
+	rel, err := filepath.Rel(m.Workspace, dir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// MemoryStore is a file-backed store of short facts, which are remembered across sessions.
+// The file is shared by the shells of the user, it is read again when another one changes it.
+type MemoryStore struct {
+	mu       sync.Mutex
+	file     string
+	memories []*Memory
+	// the modification time and size of the file when it was read
+	modTime time.Time
+	size    int64
+}
+
+var (
+	memoryStore     *MemoryStore
+	memoryStoreErr  error
+	memoryStoreOnce sync.Once
+)
+
+// GetMemoryStore returns the memory store of the current user, which is loaded on first use.
+func GetMemoryStore() (*MemoryStore, error) {
+	memoryStoreOnce.Do(func() {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			memoryStoreErr = err
+			return
+		}
+		memoryStore, memoryStoreErr = OpenMemoryStore(filepath.Join(home, MemoryFileName))
+	})
+	return memoryStore, memoryStoreErr
+}
+
+func OpenMemoryStore(file string) (*MemoryStore, error) {
+	s := &MemoryStore{file: file}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the memories from the file, unless it is unchanged since it was read.
+func (s *MemoryStore) load() error {
+	stat, err := os.Stat(s.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.memories, s.modTime, s.size = nil, time.Time{}, 0
+			return nil
+		}
+		return err
+	}
+	if stat.ModTime().Equal(s.modTime) && stat.Size() == s.size {
+		return nil
+	}
+
+	b, err := os.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+	var memories []*Memory
+	if err := json.Unmarshal(b, &memories); err != nil {
+		return fmt.Errorf("%s: %w", s.file, err)
+	}
+	s.memories, s.modTime, s.size = memories, stat.ModTime(), stat.Size()
+	return nil
+}
+
+// update changes the memories under the lock of the file, once they are read again, so that the changes
+// of the other shells are kept. The memories are left unchanged if they can't be saved.
+func (s *MemoryStore) update(change func(memories []*Memory) []*Memory) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := LockFile(s.file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	memories := change(append([]*Memory(nil), s.memories...))
+	if err := s.save(memories); err != nil {
+		return err
+	}
+	s.memories = memories
+	// read again by the next call, which records the modification time of the file
+	s.modTime = time.Time{}
+	return nil
+}
+
+func (s *MemoryStore) Add(content string, scope MemoryScope, workspace string, tags []string) (*Memory, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, fmt.Errorf("empty memory")
+	}
+
+	switch scope {
+	case MemoryScopeGlobal:
+		workspace = ""
+	case MemoryScopeWorkspace:
+		if workspace == "" {
+			return nil, fmt.Errorf("workspace memory without workspace")
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown memory scope", scope)
+	}
+
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	m := &Memory{
+		ID:        hex.EncodeToString(id),
+		Content:   content,
+		Scope:     scope,
+		Workspace: workspace,
+		Tags:      tags,
+		CreatedAt: time.Now(),
+	}
+
+	err := s.update(func(memories []*Memory) []*Memory {
+		return append(memories, m)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Remove removes the memory with the given ID, and reports whether it existed.
+func (s *MemoryStore) Remove(id string) (bool, error) {
+	found := false
+	err := s.update(func(memories []*Memory) []*Memory {
+		for i, m := range memories {
+			if m.ID == id {
+				found = true
+				return append(memories[:i], memories[i+1:]...)
+			}
+		}
+		return memories
+	})
+	return found, err
+}
+
+// List returns the memories visible in the given directory, or all memories when dir is empty.
+func (s *MemoryStore) List(dir string) []*Memory {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the memories read last are kept if the file can't be read
+	s.load()
+
+	memories := make([]*Memory, 0, len(s.memories))
+	for _, m := range s.memories {
+		if dir == "" || m.VisibleIn(dir) {
+			memories = append(memories, m)
+		}
+	}
+	return memories
+}
+
+// Search returns at most limit memories visible in the given directory, ranked by their BM25 relevance to the query.
+func (s *MemoryStore) Search(query string, dir string, limit int) []*Memory {
+	memories := s.List(dir)
+	terms := tokenizeMemory(query)
+	if len(memories) == 0 || len(terms) == 0 || limit <= 0 {
+		return nil
+	}
+
+	const k1, b = 1.2, 0.75
+
+	docs := make([][]string, len(memories))
+	df := map[string]int{}
+	total := 0
+	for i, m := range memories {
+		docs[i] = tokenizeMemory(m.Content + " " + strings.Join(m.Tags, " "))
+		total += len(docs[i])
+		seen := map[string]bool{}
+		for _, term := range docs[i] {
+			if !seen[term] {
+				seen[term] = true
+				df[term]++
+			}
+		}
+	}
+	avgdl := float64(total) / float64(len(docs))
+
+	type scored struct {
+		memory *Memory
+		score  float64
+	}
+	results := make([]scored, 0, len(memories))
+
+	for i, doc := range docs {
+		tf := map[string]int{}
+		for _, term := range doc {
+			tf[term]++
+		}
+
+		score := 0.0
+		for _, term := range terms {
+			f := float64(tf[term])
+			if f == 0 {
+				continue
+			}
+			n := float64(df[term])
+			idf := math.Log(1 + (float64(len(docs))-n+0.5)/(n+0.5))
+			score += idf * f * (k1 + 1) / (f + k1*(1-b+b*float64(len(doc))/max(avgdl, 1)))
+		}
+		if score > 0 {
+			results = append(results, scored{memory: memories[i], score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+
+	found := make([]*Memory, 0, min(limit, len(results)))
+	for _, r := range results[:min(limit, len(results))] {
+		found = append(found, r.memory)
+	}
+	return found
+}
+
+func (s *MemoryStore) save(memories []*Memory) error {
+	b, err := json.MarshalIndent(memories, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+var memoryStopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"do": true, "for": true, "from": true, "how": true, "i": true, "in": true, "is": true, "it": true,
+	"me": true, "my": true, "of": true, "on": true, "or": true, "our": true, "the": true, "this": true,
+	"to": true, "we": true, "what": true, "with": true, "you": true, "your": true,
+}
+
+func tokenizeMemory(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		if !memoryStopwords[w] {
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
@@ -10,6 +10,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -33,13 +34,18 @@ type Shell struct {
 	fileName         string
 	absoluteFileName string
 
-	capturedStdout *os.File
-	capturedStderr *os.File
-
-	runner  *interp.Runner
-	environ []string
-	params  []string
-	exit    bool
+	capturedStdout io.Writer
+	capturedStderr io.Writer
+	captureWg      sync.WaitGroup
+	execMu         sync.Mutex
+
+	runner       *interp.Runner
+	runnerStdout io.Writer
+	runnerStderr io.Writer
+	environ      []string
+	params       []string
+	exit         bool
+	exitStatus   interp.ExitStatus
 }
 
 type ShellOption func(*Shell)
@@ -93,7 +99,7 @@ func NewShell(opts ...ShellOption) (*Shell, error) {
 	if capturedStdout, err := NewCapturedStdIO(s, s.stdout); err == nil {
 		s.capturedStdout = capturedStdout
 	} else {
-		s.capturedStderr = s.stdout
+		s.capturedStdout = s.stdout
 	}
 	if capturedStderr, err := NewCapturedStdIO(s, s.stderr); err == nil {
 		s.capturedStderr = capturedStderr
@@ -127,6 +133,7 @@ func NewShell(opts ...ShellOption) (*Shell, error) {
 		return nil, err
 	}
 	s.runner = r
+	s.runnerStdout, s.runnerStderr = s.stdout, s.stderr
 	return s, nil
 }
 
@@ -140,6 +147,17 @@ func (s *Shell) Use(plugin ...ShellPlugin) error {
 	return nil
 }
 
+// Close releases the resources of the plugins, once the shell is done.
+func (s *Shell) Close() {
+	for _, plugin := range s.plugins {
+		if closer, ok := plugin.(ShellPluginCloser); ok {
+			if err := closer.Close(s); err != nil {
+				s.PrintError(s.stderr, err)
+			}
+		}
+	}
+}
+
 func (s *Shell) State() *ShellState {
 	return s.state
 }
@@ -307,8 +325,27 @@ func (s *Shell) readlines(
 			continue
 		}
 
+		if question, ok := rawQuestion(cio.Bytes()); ok {
+			cio.Close()
+			// the raw question is asked to the AI as it is typed, without being parsed and expanded by the shell
+			if err := s.runCommandExecution(ce, s.questionAST([]byte(question)), cio.Bytes(), s.stderr, nil); err != nil {
+				return err
+			}
+			if s.exit {
+				break
+			}
+			continue
+		}
+
+		prose := false
 		err := parser.Interactive(cio, func(stmts []*syntax.Stmt) bool {
 			if parser.Incomplete() {
+				// don't wait for the closing quote of an apostrophe, e.g. "what's using port 80?",
+				// scripts and piped input are never asked, they are command lines
+				if interactiveReader != nil && !ce.incomplete && !s.asksCommand(cio.Bytes()) && isProse(cio.Bytes()) {
+					prose = true
+					return false
+				}
 				ce.incomplete = true
 				if err := waitNextLine(); err != nil {
 					if err == context.Canceled {
@@ -326,48 +363,79 @@ func (s *Shell) readlines(
 		})
 		cio.Close()
 
-		if err != nil {
+		if prose || err != nil && !interrupt && interactiveReader != nil && !s.asksCommand(cio.Bytes()) {
+			// the input typed on a terminal which is not a command line is asked to the AI as it is
+			ast = s.questionAST(cio.Bytes())
+			ce.incomplete = false
+		} else if err != nil {
 			if !interrupt {
 				s.PrintError(s.stderr, err)
 			}
 			continue
 		}
 
-		s.state.SetCurrentExecution(ce)
-		for _, plugin := range s.plugins {
-			if c, err := plugin.PrepareContext(ce, s); err != nil {
-				return err
-			} else if c != nil {
-				ce.ctx = c
-			}
+		if err := s.runCommandExecution(ce, ast, cio.Bytes(), s.stderr, nil); err != nil {
+			return err
 		}
 
-		if err := s.evalAST(ce, ast, nil); err != nil {
-			if err == ErrPanic {
-				err = s.handlePanic(ce, err, cio.Bytes())
-			}
-
-			if err != nil {
-				s.PrintError(s.stderr, err)
-			}
+		if s.exit {
+			break
 		}
+	}
+	return nil
+}
 
-		for _, plugin := range s.plugins {
-			if err := plugin.End(ce, s); err != nil {
-				s.PrintError(s.stderr, err)
-			}
-		}
+// runCommandExecution evaluates a parsed command line as the current execution, which is seen by the plugins
+// from the preparation of its context to its end, errors other than exit statuses are printed to stderr.
+func (s *Shell) runCommandExecution(
+	ce *CommandExecution,
+	ast *syntax.File,
+	input []byte,
+	stderr io.Writer,
+	modifierFunc func(sce *SubCommandExecution),
+) error {
+	ce.input = input
+	s.state.SetCurrentExecution(ce)
+	defer func() {
 		ce.terminated = true
 		s.state.SetCurrentExecution(nil)
+	}()
 
-		if s.exit {
-			break
+	for _, plugin := range s.plugins {
+		if c, err := plugin.PrepareContext(ce, s); err != nil {
+			return err
+		} else if c != nil {
+			ce.ctx = c
+		}
+	}
+
+	err := s.evalAST(ce, ast, modifierFunc)
+	if err == ErrPanic {
+		err = s.handlePanic(ce, err, input)
+	}
+	s.setExitStatus(err)
+	ce.exitStatus = s.exitStatus
+	if _, ok := err.(interp.ExitStatus); !ok && err != nil {
+		s.PrintError(stderr, err)
+	}
+
+	for _, plugin := range s.plugins {
+		if err := plugin.End(ce, s); err != nil {
+			s.PrintError(stderr, err)
 		}
 	}
 	return nil
 }
 
 func (s *Shell) Start(ctx context.Context) error {
+	defer s.flushCapturedStdIO()
+
+	s.ReadConfig(ctx)
+	return s.readlines(ctx, s.stdin)
+}
+
+// ReadConfig sources the rc files of the home and the working directory.
+func (s *Shell) ReadConfig(ctx context.Context) {
 	if home, err := os.UserHomeDir(); err == nil {
 		s.readWorkspaceConfig(ctx, home)
 	}
@@ -375,8 +443,29 @@ func (s *Shell) Start(ctx context.Context) error {
 	if wd, err := os.Getwd(); err == nil {
 		s.readWorkspaceConfig(ctx, wd)
 	}
+}
 
-	return s.readlines(ctx, s.stdin)
+// Exec evaluates the code as a command line typed by the user, but with its output written to the given writers
+// instead of the shell's stdio, the output is still captured for the AI. It is used to control the shell
+// programmatically, and the calls are serialized.
+func (s *Shell) Exec(ctx context.Context, code string, stdout io.Writer, stderr io.Writer) (*CommandExecution, error) {
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+
+	ast, err := syntax.NewParser().Parse(strings.NewReader(code), s.fileName)
+	if err != nil {
+		s.setExitStatus(interp.ExitStatus(2))
+		return nil, err
+	}
+
+	ce := s.newCommandExecution(ctx, false)
+	stdout = &executionDualWriter{stdWriter: stdout, s: s}
+	stderr = &executionDualWriter{stdWriter: stderr, s: s}
+
+	err = s.withStdIO(stdout, stderr, func() error {
+		return s.runCommandExecution(ce, ast, []byte(code), stderr, nil)
+	})
+	return ce, err
 }
 
 func (s *Shell) evalAST(ce *CommandExecution, ast *syntax.File, modifierFunc func(sce *SubCommandExecution)) (err error) {
@@ -387,7 +476,12 @@ func (s *Shell) evalAST(ce *CommandExecution, ast *syntax.File, modifierFunc fun
 	}()
 
 	ast.Name = s.fileName
-	runnerCtx := context.WithValue(ce.parentCtx, commandExecutionKey{}, ce)
+	ctx := ce.parentCtx
+	if ce.limited {
+		// the code is stopped between its commands too, e.g. a loop of builtins
+		ctx = ce.ctx
+	}
+	runnerCtx := context.WithValue(ctx, commandExecutionKey{}, ce)
 	if modifierFunc != nil {
 		runnerCtx = context.WithValue(runnerCtx, modifierFuncKey{}, modifierFunc)
 	}
@@ -416,10 +510,117 @@ func (s *Shell) Eval(ce *CommandExecution, code []byte, modifierFunc func(sce *S
 	return s.evalAST(ce, ast, modifierFunc)
 }
 
+func (s *Shell) setExitStatus(err error) {
+	switch err := err.(type) {
+	case nil:
+		s.exitStatus = 0
+	case interp.ExitStatus:
+		s.exitStatus = err
+	default:
+		s.exitStatus = 1
+	}
+}
+
+// ExitStatus returns the exit status of the last evaluated command line, which is
+// used as the exit status of the shell process.
+func (s *Shell) ExitStatus() int {
+	return int(s.exitStatus)
+}
+
+// EvalWithStdIO is like Eval, but the output of the code is written to the given writers instead of the shell's stdio.
+func (s *Shell) EvalWithStdIO(
+	ce *CommandExecution,
+	code []byte,
+	stdout io.Writer,
+	stderr io.Writer,
+	modifierFunc func(sce *SubCommandExecution),
+) error {
+	return s.withStdIO(stdout, stderr, func() error {
+		return s.Eval(ce, code, modifierFunc)
+	})
+}
+
+// EvalWithLimits is like EvalWithStdIO, but the code is stopped with a LimitError once it runs longer than
+// the timeout, or writes more than maxOutput bytes, zero means no limit. The limits apply to the code as a whole,
+// with its builtins, loops and pipelines, but not to the output of the redirections. The output is written to
+// the terminal of the shell if stdout is nil.
+func (s *Shell) EvalWithLimits(
+	ce *CommandExecution,
+	code []byte,
+	stdout io.Writer,
+	stderr io.Writer,
+	timeout time.Duration,
+	maxOutput int64,
+	modifierFunc func(sce *SubCommandExecution),
+) error {
+	ctx, stop := context.WithCancelCause(ce.ctx)
+	defer stop(nil)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, &LimitError{Timeout: timeout})
+		defer cancel()
+	}
+	var limiter *outputLimiter
+	if maxOutput > 0 {
+		limiter = &outputLimiter{remaining: maxOutput, exceeded: func() {
+			stop(&LimitError{MaxOutput: maxOutput})
+		}}
+	}
+
+	prevCtx, prevLimited := ce.ctx, ce.limited
+	ce.ctx, ce.limited = ctx, true
+	defer func() {
+		ce.ctx, ce.limited = prevCtx, prevLimited
+	}()
+
+	var err error
+	if stdout == nil {
+		// the output is limited as it is copied from the terminal of the commands, which they keep,
+		// the builtins write to it too
+		prevLimiter := ce.limiter.Swap(limiter)
+		defer ce.limiter.Store(prevLimiter)
+		err = s.withStdIO(s.capturedStdout, s.capturedStderr, func() error {
+			return s.Eval(ce, code, modifierFunc)
+		})
+	} else {
+		if limiter != nil {
+			stdout, stderr = limiter.writer(stdout), limiter.writer(stderr)
+		}
+		err = s.EvalWithStdIO(ce, code, stdout, stderr, modifierFunc)
+	}
+
+	// the output may be truncated at the end of a command line which is done
+	var limitErr *LimitError
+	if errors.As(context.Cause(ctx), &limitErr) {
+		// the runner is stopped for the code only, the command line which evaluates it and the shell go on,
+		// running nothing clears the fatal error it keeps
+		_ = s.runner.Run(ce.parentCtx, &syntax.File{Name: s.fileName})
+		s.exit = false
+		return limitErr
+	}
+	return err
+}
+
+// withStdIO calls fn with the output of the runner redirected to the given writers.
+func (s *Shell) withStdIO(stdout io.Writer, stderr io.Writer, fn func() error) error {
+	prevStdout, prevStderr := s.runnerStdout, s.runnerStderr
+	if err := interp.StdIO(s.stdin, stdout, stderr)(s.runner); err != nil {
+		return err
+	}
+	s.runnerStdout, s.runnerStderr = stdout, stderr
+	defer func() {
+		_ = interp.StdIO(s.stdin, prevStdout, prevStderr)(s.runner)
+		s.runnerStdout, s.runnerStderr = prevStdout, prevStderr
+	}()
+
+	return fn()
+}
+
 func (s *Shell) processSignal(sig os.Signal) {
 	switch sig {
 	case syscall.SIGINT:
-		if ce := s.state.CurrentExecution(); ce != nil {
+		// the first interrupt stops the generation of an answer, the next one cancels the command line
+		if ce := s.state.CurrentExecution(); ce != nil && !ce.Interrupt() {
 			ce.Cancel()
 		}
 	}
@@ -433,10 +634,27 @@ func (s *Shell) LookPath(file string) (string, error) {
 	return LookPath(file, s.Dir(), s.runner.Env.Get("PATH").String())
 }
 
+// Getenv returns the value of a variable of the shell, empty if it is not set.
+func (s *Shell) Getenv(name string) string {
+	return s.runner.Env.Get(name).String()
+}
+
 func (s *Shell) FindExecutableNames() ([]string, error) {
 	return FindExecutableNames(s.runner.Env.Get("PATH").String(), s.Dir())
 }
 
+// Environ returns the exported variables of the shell, in the form of "key=value".
+func (s *Shell) Environ() []string {
+	environ := []string{}
+	s.runner.Env.Each(func(name string, vr expand.Variable) bool {
+		if vr.Exported && vr.IsSet() {
+			environ = append(environ, name+"="+vr.String())
+		}
+		return true
+	})
+	return environ
+}
+
 func (s *Shell) AbsoluteFileName() string {
 	return s.absoluteFileName
 }
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/creack/pty"
 )
@@ -37,27 +38,46 @@ type executionDualWriter struct {
 var _ io.Writer = (*executionDualWriter)(nil)
 
 func (w *executionDualWriter) Write(p []byte) (n int, err error) {
-	n, err = w.stdWriter.Write(p)
-	if err != nil {
-		return n, err
+	ce := w.s.State().CurrentExecution()
+	written := len(p)
+	if ce != nil {
+		if limiter := ce.limiter.Load(); limiter != nil {
+			// the output beyond the limit is discarded
+			p = p[:limiter.take(len(p))]
+		}
+	}
+
+	if _, err = w.stdWriter.Write(p); err != nil {
+		return 0, err
 	}
 
 	// write stdout or stderr to the current execution buffer, which will be used to generate AI messages
-	if ce := w.s.State().CurrentExecution(); ce != nil {
-		return ce.Buffer().Write(p)
+	if ce != nil && !ce.Withheld() {
+		ce.Buffer().Write(p)
 	}
-	return len(p), nil
+	return written, nil
 }
 
-func NewCapturedStdIO(shell *Shell, writer io.Writer) (*os.File, error) {
+func NewCapturedStdIO(shell *Shell, writer io.Writer) (io.Writer, error) {
+	// when the writer is not a terminal, there is no need to emulate one, so the content is
+	// copied synchronously, which ensures it is in the execution buffer once a command returns
+	if !IsInteractive(writer) {
+		return &executionDualWriter{stdWriter: writer, s: shell}, nil
+	}
+
 	pr, pw, err := pty.Open()
 	if err != nil {
 		return nil, err
 	}
 	capturedIOs = append(capturedIOs, pw)
-	sigwinch <- syscall.SIGWINCH
+	select {
+	case sigwinch <- syscall.SIGWINCH:
+	default:
+	}
 
+	shell.captureWg.Add(1)
 	go func() {
+		defer shell.captureWg.Done()
 		io.Copy(
 			&executionDualWriter{stdWriter: writer, s: shell},
 			pr,
@@ -68,3 +88,49 @@ func NewCapturedStdIO(shell *Shell, writer io.Writer) (*os.File, error) {
 
 	return pw, nil
 }
+
+// uncaptured returns the original writer of a captured stdio, so that the written content
+// is not copied to the execution buffer.
+func (s *Shell) uncaptured(writer io.Writer) io.Writer {
+	switch writer {
+	case s.capturedStdout:
+		return s.stdout
+	case s.capturedStderr:
+		return s.stderr
+	}
+	if w, ok := writer.(*executionDualWriter); ok {
+		return w.stdWriter
+	}
+	return writer
+}
+
+// isOutput reports whether the writer is the output of the shell, rather than a pipe or a file a command writes to.
+func (s *Shell) isOutput(writer io.Writer) bool {
+	switch writer {
+	case s.stdout, s.stderr, s.capturedStdout, s.capturedStderr, s.runnerStdout, s.runnerStderr:
+		return true
+	}
+	return false
+}
+
+// flushCapturedStdIO closes the captured stdio and waits for the pending content to be
+// copied to the original writers, so that nothing is lost when the shell exits.
+func (s *Shell) flushCapturedStdIO() {
+	for _, w := range []io.Writer{s.capturedStdout, s.capturedStderr} {
+		if f, ok := w.(*os.File); ok && f != s.stdout && f != s.stderr {
+			_ = f.Close()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.captureWg.Wait()
+		close(done)
+	}()
+
+	// a background process may still hold the captured stdio
+	select {
+	case <-done:
+	case <-time.After(s.killTimeout):
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"runtime"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+	"unicode"
 
 	"mvdan.cc/sh/v3/expand"
 	"mvdan.cc/sh/v3/interp"
@@ -68,7 +71,33 @@ func (s *Shell) execHandler(ctx context.Context, args []string) error {
 		}
 	}
 
-	return nil
+	return exitStatusOf(sce.err)
+}
+
+// exitStatusOf converts the error of a sub command into the exit status reported to the runner,
+// errors other than exit statuses are already reported by plugins, so they only affect "$?".
+func exitStatusOf(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrInterrupted):
+		return interp.ExitStatus(130)
+	case errors.As(err, new(*LimitError)):
+		// as timeout(1) does
+		return interp.ExitStatus(124)
+	}
+	if status, ok := err.(interp.ExitStatus); ok {
+		return status
+	}
+	return interp.ExitStatus(1)
+}
+
+// ExitStatusOf returns the exit status of a command which returned the error.
+func ExitStatusOf(err error) int {
+	if status, ok := exitStatusOf(err).(interp.ExitStatus); ok {
+		return int(status)
+	}
+	return 0
 }
 
 func execEnv(env expand.Environ) []string {
@@ -99,35 +128,79 @@ func (s *Shell) handlePanic(ce *CommandExecution, err error, input []byte) error
 	}
 
 	// If panic occurs, as fallback, we use the whole user input as a command to interact with AI
-	ast := &syntax.File{
+	return s.evalAST(ce, s.questionAST(input), nil)
+}
+
+// the command asking a question to the AI, which is handled by the plugins
+const askCommand = "ai:"
+
+// questionAST returns a command line asking the raw input to the AI, as a single quoted word after "ai: --",
+// so that it is asked as it is, e.g. when it can not be parsed as a command line. The input is never the name
+// of the command, a question such as "exit" would run the builtin.
+func (s *Shell) questionAST(input []byte) *syntax.File {
+	word := func(part syntax.WordPart) *syntax.Word {
+		return &syntax.Word{Parts: []syntax.WordPart{part}}
+	}
+	return &syntax.File{
 		Name: s.fileName,
 		Stmts: []*syntax.Stmt{
 			{
 				Position: syntax.NewPos(0, 0, 0),
 				Cmd: &syntax.CallExpr{
 					Args: []*syntax.Word{
-						{
-							Parts: []syntax.WordPart{
-								&syntax.DblQuoted{
-									Parts: []syntax.WordPart{
-										&syntax.Lit{
-											Value: string(input),
-										},
-									},
-								},
-							},
-						},
+						word(&syntax.Lit{Value: askCommand}),
+						// the end of the options, the question may start with "-"
+						word(&syntax.Lit{Value: "--"}),
+						word(&syntax.SglQuoted{Value: strings.TrimSpace(string(input))}),
 					},
 				},
 			},
 		},
 	}
+}
 
-	return s.evalAST(ce, ast, nil)
+// the prefixes of a raw question, which is asked to the AI as it is typed
+var rawQuestionPrefixes = []string{"ai::", "?"}
+
+// rawQuestion returns the question of an input starting with a raw question prefix, e.g. "? how do I match *.log files?".
+func rawQuestion(input []byte) (string, bool) {
+	line := strings.TrimSpace(string(input))
+	for _, prefix := range rawQuestionPrefixes {
+		if question, ok := strings.CutPrefix(line, prefix); ok && strings.TrimSpace(question) != "" {
+			return strings.TrimSpace(question), true
+		}
+	}
+	return "", false
+}
+
+// asksCommand reports whether the input is explicitly a command line, i.e. in user mode or with the "user:" prefix.
+func (s *Shell) asksCommand(input []byte) bool {
+	if s.state.Mode() == ShellModeUser {
+		return true
+	}
+	fields := strings.Fields(string(input))
+	return len(fields) > 0 && (fields[0] == "user:" || fields[0] == "::")
+}
+
+// isProse reports whether an incomplete input is a sentence rather than the beginning of a multiline
+// command line, i.e. its unclosed quote is an apostrophe in a word, e.g. "what's using port 80?".
+func isProse(input []byte) bool {
+	line := strings.TrimSpace(string(input))
+	if line == "" || strings.ContainsRune(line, '\n') || strings.Count(line, "'")%2 == 0 {
+		return false
+	}
+
+	runes := []rune(line)
+	for i := 1; i+1 < len(runes); i++ {
+		if runes[i] == '\'' && unicode.IsLetter(runes[i-1]) && unicode.IsLetter(runes[i+1]) {
+			return true
+		}
+	}
+	return false
 }
 
 func (sce *SubCommandExecution) DefaultExecHandler() error {
-	ctx, shell, hc, args, mode := sce.ce.ctx, sce.ce.shell, sce.hc, sce.fields, sce.mode
+	shell, hc, args, mode := sce.ce.shell, sce.hc, sce.fields, sce.mode
 
 	path, err := interp.LookPathDir(hc.Dir, hc.Env, args[0])
 	if err != nil {
@@ -136,6 +209,8 @@ func (sce *SubCommandExecution) DefaultExecHandler() error {
 		}
 		return interp.ExitStatus(127)
 	}
+
+	ctx := sce.ce.ctx
 	cmd := exec.Cmd{
 		Path:   path,
 		Args:   args,
@@ -145,6 +220,10 @@ func (sce *SubCommandExecution) DefaultExecHandler() error {
 		Stdout: hc.Stdout,
 		Stderr: hc.Stderr,
 	}
+	if sce.ce.limited {
+		// the children of a command stopped for its limits may keep its output open, it is not waited for
+		cmd.WaitDelay = limitedWaitDelay
+	}
 
 	err = cmd.Start()
 	if err == nil {
@@ -162,6 +241,16 @@ func (sce *SubCommandExecution) DefaultExecHandler() error {
 		defer stopf()
 
 		err = cmd.Wait()
+
+		// the command line is stopped, a LimitError is the cause of its context
+		var limitErr *LimitError
+		if errors.As(context.Cause(ctx), &limitErr) {
+			return limitErr
+		}
+		// the command succeeded, the output of its children running in the background is not read
+		if errors.Is(err, exec.ErrWaitDelay) {
+			err = nil
+		}
 	}
 
 	switch err := err.(type) {
@@ -186,3 +275,47 @@ func (sce *SubCommandExecution) DefaultExecHandler() error {
 		return err
 	}
 }
+
+// the time the output of a command stopped for its limits is still read, once it has exited
+const limitedWaitDelay = time.Second
+
+// outputLimiter limits the output of a command line, which is shared by all its commands.
+type outputLimiter struct {
+	mu        sync.Mutex
+	remaining int64
+	// called once the output exceeds the limit
+	exceeded func()
+}
+
+// take counts n bytes of output, and returns how many of them are within the limit.
+func (l *outputLimiter) take(n int) int {
+	l.mu.Lock()
+	taken := min(int64(n), max(l.remaining, 0))
+	exceeded := l.remaining >= 0 && int64(n) > l.remaining
+	l.remaining -= int64(n)
+	l.mu.Unlock()
+
+	if exceeded {
+		l.exceeded()
+	}
+	return int(taken)
+}
+
+func (l *outputLimiter) writer(w io.Writer) io.Writer {
+	return &limitedWriter{limiter: l, w: w}
+}
+
+type limitedWriter struct {
+	limiter *outputLimiter
+	w       io.Writer
+}
+
+// Write implements io.Writer, the output beyond the limit is discarded.
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if n := w.limiter.take(len(p)); n > 0 {
+		if _, err := w.w.Write(p[:n]); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
@@ -23,3 +23,9 @@ type ShellPlugin interface {
 	Execute(ce *CommandExecution, sce *SubCommandExecution, shell *Shell) (ok bool, err error)
 	AfterExecute(ce *CommandExecution, sce *SubCommandExecution, shell *Shell) error
 }
+
+// ShellPluginCloser is implemented by the plugins which release resources when the shell exits,
+// e.g. remove their temporary files.
+type ShellPluginCloser interface {
+	Close(shell *Shell) error
+}
@@ -1,6 +1,8 @@
 package base
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"os/user"
 	"runtime"
 	"sync"
@@ -18,6 +20,7 @@ type ShellState struct {
 	os               string
 	arch             string
 	user             *user.User
+	session          string
 	mode             ShellMode
 	currentExecution *CommandExecution
 	mu               sync.RWMutex
@@ -29,11 +32,17 @@ func NewDefaultShellState() (*ShellState, error) {
 		return nil, err
 	}
 
+	session := make([]byte, 4)
+	if _, err := rand.Read(session); err != nil {
+		return nil, err
+	}
+
 	return &ShellState{
-		os:   runtime.GOOS,
-		arch: runtime.GOARCH,
-		user: user,
-		mode: ShellModeAuto,
+		os:      runtime.GOOS,
+		arch:    runtime.GOARCH,
+		user:    user,
+		session: hex.EncodeToString(session),
+		mode:    ShellModeAuto,
 	}, nil
 }
 
@@ -43,6 +52,13 @@ func (s *ShellState) User() *user.User {
 	return s.user
 }
 
+// Session returns the id of the shell process, e.g. to tell its records in the audit log.
+func (s *ShellState) Session() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.session
+}
+
 func (s *ShellState) Mode() ShellMode {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
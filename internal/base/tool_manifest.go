@@ -0,0 +1,374 @@
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// The risk levels of the tool calls, how much harm they can do if the AI is misled into making them.
+const (
+	ToolRiskLow    = "low"
+	ToolRiskMedium = "medium"
+	ToolRiskHigh   = "high"
+)
+
+// the longest name of a tool, the names of the tools given to the AI are at most 64 characters long with their prefix
+const maxToolNameLength = 59
+
+var (
+	toolNameRe    = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	envNameRe     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+)
+
+// ToolManifest declares a tool running an executable, whose parameters are typed by a JSON schema.
+// It is written in YAML or JSON, and loaded by "aitool load".
+type ToolManifest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// the executable, relative to the directory of the manifest or looked up in PATH, it is absolute once loaded
+	Command string `json:"command"`
+	// the JSON schema of the parameters, an object whose properties are the parameters
+	Parameters JSONSchema `json:"parameters"`
+	// the arguments of the command, "{{name}}" is replaced with the value of a parameter
+	Args []ToolManifestArg `json:"args"`
+	// the environment variables of the command, whose values may refer to the parameters too
+	Env map[string]string `json:"env"`
+	// the standard input of the command, which may refer to the parameters too
+	Stdin string `json:"stdin"`
+	// the working directory of the command, relative to the directory of the manifest, the working directory
+	// of the shell if empty. It is absolute once loaded.
+	Dir     string      `json:"dir"`
+	Timeout ToolTimeout `json:"timeout"`
+	// low, medium or high, the user is asked to approve the high risk calls
+	Risk string `json:"risk"`
+
+	// the manifest file
+	File string `json:"-"`
+}
+
+// ToolManifestArg is an argument of the command, or a group of arguments given as a list. A group is given only
+// if the parameters it refers to are set and not false, the boolean parameters are the conditions of their group
+// and add nothing to it, e.g. ["--verbose", "{{verbose}}"].
+//
+// An argument which is a single placeholder is left out if the parameter is not set, and an array gives
+// an argument for each item.
+type ToolManifestArg struct {
+	Values []string
+	Group  bool
+}
+
+func (a *ToolManifestArg) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		a.Group = true
+		return json.Unmarshal(b, &a.Values)
+	}
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return errors.New("an argument must be a string or a list of strings")
+	}
+	a.Values = []string{value}
+	return nil
+}
+
+// ToolTimeout is the timeout of a tool, given in seconds or as a duration such as "1m30s".
+type ToolTimeout time.Duration
+
+func (d *ToolTimeout) UnmarshalJSON(b []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(b, &seconds); err == nil {
+		*d = ToolTimeout(seconds * float64(time.Second))
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return errors.New("the timeout must be a number of seconds or a duration")
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		*d = ToolTimeout(seconds * float64(time.Second))
+		return nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s: invalid timeout, e.g. 30 or 1m30s", value)
+	}
+	*d = ToolTimeout(duration)
+	return nil
+}
+
+// ToolInvocation is how the command of a tool is run for a call.
+type ToolInvocation struct {
+	Command string
+	Args    []string
+	// the environment variables in the form of "key=value"
+	Env   []string
+	Stdin *string
+	Dir   string
+}
+
+// LoadToolManifest reads and validates a tool manifest, the command is looked up in PATH if it is not a path.
+func LoadToolManifest(file string, PATH string) (*ToolManifest, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is a superset of JSON, the document is decoded as JSON once read, so that it is checked strictly
+	var document any
+	if err := yaml.Unmarshal(raw, &document); err != nil {
+		return nil, fmt.Errorf("%s: invalid tool manifest: %w", file, err)
+	}
+	b, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid tool manifest: %w", file, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	m := &ToolManifest{}
+	if err := decoder.Decode(m); err != nil {
+		return nil, fmt.Errorf("%s: invalid tool manifest: %w", file, err)
+	}
+
+	m.File = file
+	if err := m.validate(PATH); err != nil {
+		return nil, fmt.Errorf("%s: invalid tool manifest: %w", file, err)
+	}
+	return m, nil
+}
+
+func (m *ToolManifest) validate(PATH string) error {
+	switch {
+	case m.Name == "":
+		return errors.New("missing name")
+	case !toolNameRe.MatchString(m.Name) || len(m.Name) > maxToolNameLength:
+		return fmt.Errorf("%s: invalid name, it must be at most %d letters, digits, _ or -", m.Name, maxToolNameLength)
+	case strings.TrimSpace(m.Description) == "":
+		return errors.New("missing description")
+	case m.Command == "":
+		return errors.New("missing command")
+	case m.Timeout < 0:
+		return errors.New("negative timeout")
+	}
+
+	command := m.Command
+	if strings.Contains(command, "/") {
+		if !filepath.IsAbs(command) {
+			command = filepath.Join(filepath.Dir(m.File), command)
+		}
+		if _, err := os.Stat(command); err != nil {
+			return fmt.Errorf("%s: command not found", m.Command)
+		}
+	} else if path, err := LookPath(command, filepath.Dir(m.File), PATH); err == nil {
+		command = path
+	} else {
+		return fmt.Errorf("%s: command not found", m.Command)
+	}
+	m.Command = filepath.Clean(command)
+
+	if m.Dir != "" {
+		if !filepath.IsAbs(m.Dir) {
+			m.Dir = filepath.Join(filepath.Dir(m.File), m.Dir)
+		}
+		m.Dir = filepath.Clean(m.Dir)
+		if stat, err := os.Stat(m.Dir); err != nil || !stat.IsDir() {
+			return fmt.Errorf("%s: not a directory", m.Dir)
+		}
+	}
+
+	switch m.Risk {
+	case "":
+		m.Risk = ToolRiskMedium
+	case ToolRiskLow, ToolRiskMedium, ToolRiskHigh:
+	default:
+		return fmt.Errorf("%s: invalid risk, it must be %s, %s or %s", m.Risk, ToolRiskLow, ToolRiskMedium, ToolRiskHigh)
+	}
+
+	if m.Parameters == nil {
+		m.Parameters = JSONSchema{"type": "object", "properties": map[string]any{}}
+	}
+	if m.Parameters["type"] != "object" {
+		return errors.New("the parameters must be a JSON schema of type object")
+	}
+	if err := m.Parameters.CheckKeywords(); err != nil {
+		return fmt.Errorf("parameters: %w", err)
+	}
+	properties, _ := m.Parameters["properties"].(map[string]any)
+
+	templates := []string{m.Stdin}
+	for _, arg := range m.Args {
+		templates = append(templates, arg.Values...)
+	}
+	for name, value := range m.Env {
+		if !envNameRe.MatchString(name) {
+			return fmt.Errorf("%s: invalid environment variable name", name)
+		}
+		templates = append(templates, value)
+	}
+	for _, template := range templates {
+		for _, match := range placeholderRe.FindAllStringSubmatch(template, -1) {
+			if _, ok := properties[match[1]]; !ok {
+				return fmt.Errorf("{{%s}}: no such parameter", match[1])
+			}
+		}
+	}
+	return nil
+}
+
+// Invocation validates the parameters of a call against the schema, and returns how the command is run with them.
+func (m *ToolManifest) Invocation(params map[string]any) (*ToolInvocation, error) {
+	if params == nil {
+		params = map[string]any{}
+	}
+	if err := m.Parameters.Validate(params); err != nil {
+		return nil, err
+	}
+
+	invocation := &ToolInvocation{Command: m.Command, Dir: m.Dir}
+	for _, arg := range m.Args {
+		if !arg.Group {
+			invocation.Args = append(invocation.Args, expandArg(arg.Values[0], params)...)
+			continue
+		}
+
+		set := true
+		for _, value := range arg.Values {
+			for _, match := range placeholderRe.FindAllStringSubmatch(value, -1) {
+				if v, ok := params[match[1]]; !ok || v == nil || v == false {
+					set = false
+				}
+			}
+		}
+		if !set {
+			continue
+		}
+		for _, value := range arg.Values {
+			if name, ok := placeholderName(value); ok && params[name] == true {
+				continue
+			}
+			invocation.Args = append(invocation.Args, expandArg(value, params)...)
+		}
+	}
+
+	names := make([]string, 0, len(m.Env))
+	for name := range m.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := m.Env[name]
+		if param, ok := placeholderName(value); ok && params[param] == nil {
+			continue
+		}
+		invocation.Env = append(invocation.Env, name+"="+expandTemplate(value, params))
+	}
+
+	if m.Stdin != "" {
+		stdin := expandTemplate(m.Stdin, params)
+		invocation.Stdin = &stdin
+	}
+	return invocation, nil
+}
+
+// placeholderName returns the name of the parameter, if the value is a single placeholder.
+func placeholderName(value string) (string, bool) {
+	match := placeholderRe.FindStringSubmatchIndex(value)
+	if match == nil || match[0] != 0 || match[1] != len(value) {
+		return "", false
+	}
+	return value[match[2]:match[3]], true
+}
+
+// expandArg returns the arguments given by a template, none for a single placeholder of a parameter
+// which is not set, and one for each item of an array.
+func expandArg(value string, params map[string]any) []string {
+	if name, ok := placeholderName(value); ok {
+		switch v := params[name].(type) {
+		case nil:
+			return nil
+		case []any:
+			args := make([]string, 0, len(v))
+			for _, item := range v {
+				args = append(args, formatParam(item))
+			}
+			return args
+		}
+	}
+	return []string{expandTemplate(value, params)}
+}
+
+func expandTemplate(value string, params map[string]any) string {
+	return placeholderRe.ReplaceAllStringFunc(value, func(placeholder string) string {
+		return formatParam(params[placeholderRe.FindStringSubmatch(placeholder)[1]])
+	})
+}
+
+// formatParam formats the value of a parameter, the arrays and objects as JSON.
+func formatParam(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+// CommandLine returns the command line running the tool, its words are quoted so that the values
+// of the parameters are never expanded by the shell.
+func (i *ToolInvocation) CommandLine() (string, error) {
+	quote := func(s string) (string, error) {
+		return syntax.Quote(s, syntax.LangBash)
+	}
+
+	words := make([]string, 0, len(i.Env)+len(i.Args)+1)
+	for _, variable := range i.Env {
+		name, value, _ := strings.Cut(variable, "=")
+		quoted, err := quote(value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+		words = append(words, name+"="+quoted)
+	}
+	for _, arg := range append([]string{i.Command}, i.Args...) {
+		quoted, err := quote(arg)
+		if err != nil {
+			return "", err
+		}
+		words = append(words, quoted)
+	}
+	code := strings.Join(words, " ")
+
+	if i.Stdin != nil {
+		stdin, err := quote(*i.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("stdin: %w", err)
+		}
+		code = fmt.Sprintf("printf '%%s' %s | %s", stdin, code)
+	}
+	if i.Dir != "" {
+		dir, err := quote(i.Dir)
+		if err != nil {
+			return "", err
+		}
+		// in a subshell, so that the working directory of the shell is kept
+		code = fmt.Sprintf("(cd %s && %s)", dir, code)
+	}
+	return code, nil
+}
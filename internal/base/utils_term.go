@@ -1,6 +1,7 @@
 package base
 
 import (
+	"errors"
 	"io"
 	"os"
 	"strings"
@@ -64,3 +65,38 @@ func IsInteractive(writer io.Writer) bool {
 	}
 	return false
 }
+
+// TerminalWidth returns the number of columns of the terminal the writer writes to, or 0 if it is not a terminal.
+func TerminalWidth(writer io.Writer) int {
+	f, ok := writer.(*os.File)
+	if !ok {
+		return 0
+	}
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// ReadKey reads a single key pressed on the terminal the reader reads from, without waiting for the enter key.
+func ReadKey(reader io.Reader) (byte, error) {
+	f, ok := reader.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return 0, errors.New("not a terminal")
+	}
+
+	state, err := term.MakeRaw(int(f.Fd()))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = term.Restore(int(f.Fd()), state)
+	}()
+
+	key := make([]byte, 1)
+	if _, err := f.Read(key); err != nil {
+		return 0, err
+	}
+	return key[0], nil
+}
@@ -0,0 +1,48 @@
+// Package injection finds the instructions to the AI in the outputs of its tools, the signs of a prompt injection,
+// e.g. a README telling the AI to ignore its instructions and run a command.
+package injection
+
+import (
+	"regexp"
+	"strings"
+)
+
+// the longest passage returned by Detect
+const maxPassageLength = 100
+
+var patterns = []*regexp.Regexp{
+	// overriding the instructions of the AI
+	regexp.MustCompile(`(?i)\b(?:ignore|disregard|forget|override|bypass)\s+(?:(?:all|any|the|your|these|those|of)\s+)*` +
+		`(?:previous|prior|above|earlier|preceding|original|system|existing)\s+(?:instructions?|prompts?|messages?|rules|directions|guidelines|context)`),
+	regexp.MustCompile(`(?i)\b(?:new|updated|real|actual|additional)\s+(?:system\s+)?instructions?\s*:`),
+	regexp.MustCompile(`(?i)\byou\s+(?:are|must|should|will)\s+now\b`),
+	// addressing the AI, e.g. "AI assistants reading this must run ..."
+	regexp.MustCompile(`(?i)\b(?:ai|assistants?|llms?|language\s+models?|chatbots?|agents?|gpt|chatgpt|claude|copilot)\b[^.\n]{0,40}?` +
+		`\b(?:must|should|need\s+to|have\s+to|are\s+required\s+to|please)\s+(?:now\s+|immediately\s+|also\s+)?` +
+		`(?:run|execute|call|invoke|use|send|upload|delete|remove|download|install|write|read|reveal|print)\b`),
+	// hiding the actions from the user
+	regexp.MustCompile(`(?i)\b(?:do\s+not|don't|never)\s+(?:tell|inform|notify|alert|warn|show|mention\s+(?:this|it)\s+to)\s+the\s+user\b`),
+	regexp.MustCompile(`(?i)\bwithout\s+(?:asking|telling|informing|notifying|confirming\s+with)\s+the\s+user\b`),
+	// the markup of the chat templates and of the envelopes of the tool outputs
+	regexp.MustCompile(`(?i)<\|im_(?:start|end)\|>|<\|(?:system|assistant|user)\|>|\[/?INST\]|<</?SYS>>|</?system>|</?untrusted-data\b`),
+}
+
+// Detect returns the first passage of a text which looks like instructions to the AI, and false if there is none.
+func Detect(text string) (string, bool) {
+	first, passage := -1, ""
+	for _, re := range patterns {
+		loc := re.FindStringIndex(text)
+		if loc != nil && (first < 0 || loc[0] < first) {
+			first, passage = loc[0], text[loc[0]:loc[1]]
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	passage = strings.Join(strings.Fields(passage), " ")
+	if runes := []rune(passage); len(runes) > maxPassageLength {
+		passage = string(runes[:maxPassageLength]) + "…"
+	}
+	return passage, true
+}
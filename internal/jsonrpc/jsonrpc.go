@@ -0,0 +1,275 @@
+// Package jsonrpc implements JSON-RPC 2.0 over a stream of newline-delimited messages,
+// the transport used by MCP servers over stdio and by the headless server mode.
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+const Version = "2.0"
+
+// Standard error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+var ErrClosed = errors.New("jsonrpc: connection closed")
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc: %s (%d)", e.Message, e.Code)
+}
+
+func NewError(code int, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+type Request struct {
+	ID     json.RawMessage
+	Method string
+	Params json.RawMessage
+}
+
+// IsNotification reports whether the request expects no response.
+func (r *Request) IsNotification() bool {
+	return r.ID == nil
+}
+
+// BindParams decodes the params of the request into v.
+func (r *Request) BindParams(v any) error {
+	if len(r.Params) == 0 || bytes.Equal(r.Params, []byte("null")) {
+		return nil
+	}
+	if err := json.Unmarshal(r.Params, v); err != nil {
+		return NewError(CodeInvalidParams, "invalid params: %s", err.Error())
+	}
+	return nil
+}
+
+// Handler handles the requests and notifications sent by the peer,
+// the returned value is the result of the request, and is ignored for notifications.
+type Handler func(ctx context.Context, conn *Conn, req *Request) (any, error)
+
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *Error           `json:"error,omitempty"`
+}
+
+// Conn is a bidirectional JSON-RPC connection, both peers can send requests to each other.
+type Conn struct {
+	reader  *bufio.Reader
+	writer  io.Writer
+	handler Handler
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[string]chan *message
+	closed  bool
+
+	done chan struct{}
+}
+
+func NewConn(reader io.Reader, writer io.Writer, handler Handler) *Conn {
+	return &Conn{
+		reader:  bufio.NewReader(reader),
+		writer:  writer,
+		handler: handler,
+		pending: make(map[string]chan *message),
+		done:    make(chan struct{}),
+	}
+}
+
+// Run reads and dispatches messages until the reader is exhausted or the context is done,
+// requests are handled concurrently.
+func (c *Conn) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	wg := sync.WaitGroup{}
+	defer c.close()
+	defer wg.Wait()
+	// the pending requests are cancelled when the peer is gone
+	defer cancel()
+
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			msg := &message{}
+			if err := json.Unmarshal(line, msg); err != nil {
+				c.send(&message{ID: rawNull(), Error: NewError(CodeParseError, "parse error: %s", err.Error())})
+			} else if msg.Method != "" {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					c.handle(ctx, msg)
+				}()
+			} else if msg.ID != nil {
+				c.resolve(msg)
+			}
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// Done is closed when the connection stops reading messages.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Call sends a request and waits for its response, the result is decoded into result unless it is nil.
+func (c *Conn) Call(ctx context.Context, method string, params any, result any) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.nextID++
+	id := strconv.FormatInt(c.nextID, 10)
+	ch := make(chan *message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	rawID := json.RawMessage(id)
+	if err := c.send(&message{ID: &rawID, Method: method, Params: marshalParams(params)}); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return ErrClosed
+	case msg := <-ch:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	}
+}
+
+// Notify sends a notification, which has no response.
+func (c *Conn) Notify(method string, params any) error {
+	return c.send(&message{Method: method, Params: marshalParams(params)})
+}
+
+func (c *Conn) handle(ctx context.Context, msg *message) {
+	req := &Request{Method: msg.Method, Params: msg.Params}
+	if msg.ID != nil {
+		req.ID = *msg.ID
+	}
+
+	var result any
+	var err error
+	if c.handler == nil {
+		err = NewError(CodeMethodNotFound, "method not found: %s", msg.Method)
+	} else {
+		result, err = c.handler(ctx, c, req)
+	}
+
+	if req.IsNotification() {
+		return
+	}
+
+	resp := &message{ID: msg.ID}
+	if err != nil {
+		rpcErr := &Error{}
+		if !errors.As(err, &rpcErr) {
+			rpcErr = NewError(CodeInternalError, "%s", err.Error())
+		}
+		resp.Error = rpcErr
+	} else {
+		b, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = NewError(CodeInternalError, "%s", err.Error())
+		} else {
+			resp.Result = b
+		}
+	}
+	c.send(resp)
+}
+
+func (c *Conn) resolve(msg *message) {
+	c.mu.Lock()
+	ch, ok := c.pending[string(*msg.ID)]
+	c.mu.Unlock()
+	if ok {
+		ch <- msg
+	}
+}
+
+func (c *Conn) send(msg *message) error {
+	msg.JSONRPC = Version
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.writer.Write(append(b, '\n'))
+	return err
+}
+
+func (c *Conn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+}
+
+func marshalParams(params any) json.RawMessage {
+	if params == nil {
+		return nil
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func rawNull() *json.RawMessage {
+	raw := json.RawMessage("null")
+	return &raw
+}
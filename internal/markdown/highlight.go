@@ -0,0 +1,304 @@
+package markdown
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ruandada/aish/internal/base"
+)
+
+// language describes how the code of a language is highlighted.
+type language struct {
+	keywords map[string]bool
+	// starts a comment until the end of the line
+	comment      string
+	blockComment [2]string
+	quotes       string
+	// highlight the commands, variables and flags of shell scripts
+	shell bool
+	// highlight the identifiers followed by a colon, e.g. the keys of YAML
+	keys bool
+	// highlight the added and removed lines of a diff
+	diff bool
+}
+
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	shellLanguage = &language{
+		keywords: words("if then else elif fi for while until do done case esac in function return local export select time"),
+		comment:  "#",
+		quotes:   "\"'`",
+		shell:    true,
+	}
+	goLanguage = &language{
+		keywords: words("break case chan const continue default defer else fallthrough for func go goto if import " +
+			"interface map package range return select struct switch type var nil true false iota"),
+		comment:      "//",
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+	}
+	pythonLanguage = &language{
+		keywords: words("and as assert async await break class continue def del elif else except finally for from " +
+			"global if import in is lambda nonlocal not or pass raise return try while with yield None True False"),
+		comment: "#",
+		quotes:  "\"'",
+	}
+	javascriptLanguage = &language{
+		keywords: words("async await break case catch class const continue debugger default delete do else enum " +
+			"export extends finally for from function if implements import in instanceof interface let new of " +
+			"return static super switch this throw try type typeof var void while with yield null undefined true false"),
+		comment:      "//",
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+	}
+	rustLanguage = &language{
+		keywords: words("as async await break const continue crate dyn else enum extern false fn for if impl in let " +
+			"loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while"),
+		comment:      "//",
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"",
+	}
+	cLanguage = &language{
+		keywords: words("auto bool break case catch char class const continue default delete do double else enum " +
+			"extern false final float for goto if import int long namespace new null nullptr package private protected " +
+			"public register return short signed sizeof static struct switch template this throw true try typedef " +
+			"union unsigned using virtual void volatile while"),
+		comment:      "//",
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'",
+	}
+	jsonLanguage = &language{
+		keywords: words("true false null"),
+		quotes:   "\"",
+	}
+	yamlLanguage = &language{
+		keywords: words("true false null yes no on off"),
+		comment:  "#",
+		quotes:   "\"'",
+		keys:     true,
+	}
+	diffLanguage = &language{diff: true}
+)
+
+var languages = map[string]*language{
+	"sh":         shellLanguage,
+	"bash":       shellLanguage,
+	"zsh":        shellLanguage,
+	"shell":      shellLanguage,
+	"console":    shellLanguage,
+	"aish":       shellLanguage,
+	"go":         goLanguage,
+	"golang":     goLanguage,
+	"python":     pythonLanguage,
+	"py":         pythonLanguage,
+	"javascript": javascriptLanguage,
+	"js":         javascriptLanguage,
+	"jsx":        javascriptLanguage,
+	"typescript": javascriptLanguage,
+	"ts":         javascriptLanguage,
+	"tsx":        javascriptLanguage,
+	"rust":       rustLanguage,
+	"rs":         rustLanguage,
+	"c":          cLanguage,
+	"cpp":        cLanguage,
+	"c++":        cLanguage,
+	"java":       cLanguage,
+	"json":       jsonLanguage,
+	"yaml":       yamlLanguage,
+	"yml":        yamlLanguage,
+	"diff":       diffLanguage,
+	"patch":      diffLanguage,
+}
+
+// lookupLanguage returns the language of a code block, or nil when it is not highlighted.
+func lookupLanguage(name string) *language {
+	return languages[strings.ToLower(name)]
+}
+
+// the characters ending a word of a shell script
+const shellOperators = " \t|&;()<>\"'`$"
+
+// highlight returns the styled line of the code block.
+func (f *fence) highlight(line string) []cell {
+	lang := f.lang
+	var cells []cell
+	add := func(text string, sgr string) {
+		cells = append(cells, cell{text: text, sgr: sgr, width: stringWidth(text)})
+	}
+
+	if lang == nil {
+		add(line, "")
+		return cells
+	}
+	if lang.diff {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			add(line, base.ColorGreen)
+		case strings.HasPrefix(line, "-"):
+			add(line, base.ColorRed)
+		case strings.HasPrefix(line, "@@"):
+			add(line, base.ColorCyan)
+		default:
+			add(line, "")
+		}
+		return cells
+	}
+
+	// whether the next word of a shell script is a command
+	command := lang.shell
+
+	for i := 0; i < len(line); {
+		rest := line[i:]
+		c := line[i]
+
+		if f.comment {
+			end := strings.Index(rest, lang.blockComment[1])
+			if end < 0 {
+				add(rest, base.ColorGray)
+				break
+			}
+			end += len(lang.blockComment[1])
+			add(rest[:end], base.ColorGray)
+			f.comment = false
+			i += end
+			continue
+		}
+
+		switch {
+		case lang.comment != "" && strings.HasPrefix(rest, lang.comment) &&
+			(!lang.shell || i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			add(rest, base.ColorGray)
+			i = len(line)
+
+		case lang.blockComment[0] != "" && strings.HasPrefix(rest, lang.blockComment[0]):
+			f.comment = true
+			add(lang.blockComment[0], base.ColorGray)
+			i += len(lang.blockComment[0])
+
+		case strings.IndexByte(lang.quotes, c) >= 0:
+			end := quoteEnd(rest)
+			sgr := base.ColorGreen
+			if !lang.shell && strings.HasPrefix(strings.TrimLeft(rest[end:], " \t"), ":") {
+				sgr = base.ColorBlue
+			}
+			add(rest[:end], sgr)
+			i += end
+			command = false
+
+		case lang.shell && c == '$':
+			end := variableEnd(rest)
+			add(rest[:end], base.ColorCyan)
+			i += end
+			command = false
+
+		case c >= '0' && c <= '9' && (i == 0 || !isIdentByte(line[i-1])):
+			end := 1
+			for end < len(rest) && (isIdentByte(rest[end]) || rest[end] == '.') {
+				end++
+			}
+			add(rest[:end], base.ColorYellow)
+			i += end
+			command = false
+
+		case lang.shell && strings.IndexByte(shellOperators, c) < 0:
+			end := strings.IndexAny(rest, shellOperators)
+			if end < 0 {
+				end = len(rest)
+			}
+			word := rest[:end]
+			switch {
+			case lang.keywords[word]:
+				add(word, base.ColorPurple)
+				command = !strings.Contains(" for case in function select ", " "+word+" ")
+			case command && strings.Contains(word, "=") && !strings.HasPrefix(word, "="):
+				// an assignment before the command
+				add(word, base.ColorCyan)
+			case command:
+				add(word, base.ColorBlue)
+				command = false
+			case strings.HasPrefix(word, "-"):
+				add(word, base.ColorYellow)
+			default:
+				add(word, "")
+			}
+			i += end
+
+		case !lang.shell && isIdentByte(c):
+			end := 1
+			for end < len(rest) && isIdentByte(rest[end]) {
+				end++
+			}
+			word := rest[:end]
+			switch {
+			case lang.keywords[word]:
+				add(word, base.ColorPurple)
+			case strings.HasPrefix(rest[end:], "("):
+				add(word, base.ColorBlue)
+			case lang.keys && strings.HasPrefix(rest[end:], ":"):
+				add(word, base.ColorBlue)
+			default:
+				add(word, "")
+			}
+			i += end
+
+		default:
+			_, size := utf8.DecodeRuneInString(rest)
+			add(rest[:size], "")
+			i += size
+			if lang.shell && strings.IndexByte("|&;(", c) >= 0 {
+				command = true
+			}
+		}
+	}
+	return cells
+}
+
+// quoteEnd returns the end of the quoted string at the beginning of s, or the end of s if it is not closed.
+func quoteEnd(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote != '\'' {
+				i++
+			}
+		case quote:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// variableEnd returns the end of the shell variable at the beginning of s, e.g. $HOME, ${HOME} or $?.
+func variableEnd(s string) int {
+	if len(s) < 2 {
+		return len(s)
+	}
+	switch {
+	case s[1] == '{':
+		if end := strings.IndexByte(s, '}'); end > 0 {
+			return end + 1
+		}
+		return len(s)
+	case s[1] == '(':
+		return 1
+	case strings.IndexByte("?!#$@*-0123456789", s[1]) >= 0:
+		return 2
+	}
+	end := 1
+	for end < len(s) && isIdentByte(s[end]) {
+		end++
+	}
+	return end
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
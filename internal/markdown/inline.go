@@ -0,0 +1,263 @@
+package markdown
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ruandada/aish/internal/base"
+)
+
+const strikethrough = "\033[9m"
+
+// the characters which may start an inline marker
+const markerChars = "*_~`[]\\"
+
+// cell is a piece of styled text.
+type cell struct {
+	text  string
+	sgr   string
+	width int
+}
+
+// inlineState is the state of the inline markers, which is kept between the words of a line.
+type inlineState struct {
+	bold   bool
+	italic bool
+	strike bool
+	// the backticks closing the code span, when in one
+	code string
+	// the text and the URL of the link, when in its text
+	link    bool
+	linkURL string
+	linkTxt string
+}
+
+func (s *inlineState) sgr(style string) string {
+	if s.code != "" {
+		return base.ColorCyan
+	}
+	sgr := style
+	if s.link {
+		sgr = base.ColorBlue + base.Underline
+	}
+	if s.bold {
+		if sgr == base.ColorGray {
+			sgr = base.ColorWhite
+		}
+		sgr += base.Bold
+	}
+	if s.italic && !strings.Contains(sgr, base.Italic) {
+		sgr += base.Italic
+	}
+	if s.strike {
+		sgr += strikethrough
+	}
+	return sgr
+}
+
+// render renders the word line[start:end] with the given style, the rest of the line is looked ahead
+// to pair the markers. It returns the end of what is rendered, which may be beyond the word when it ends
+// a link, and false when the word cannot be rendered until more of the line is known.
+func (s *inlineState) render(line string, start int, end int, final bool, style string) ([]cell, int, bool) {
+	var cells []cell
+	emit := func(text string) {
+		for _, c := range text {
+			cells = append(cells, cell{text: string(c), sgr: s.sgr(style), width: runeWidth(c)})
+		}
+	}
+
+	i := start
+	for i < end {
+		c := line[i]
+
+		if s.code != "" {
+			if strings.HasPrefix(line[i:], s.code) {
+				i += len(s.code)
+				s.code = ""
+				continue
+			}
+			_, size := utf8.DecodeRuneInString(line[i:])
+			emit(line[i : i+size])
+			i += size
+			continue
+		}
+
+		switch c {
+		case '\\':
+			if i+1 == len(line) && !final {
+				return nil, 0, false
+			}
+			if i+1 < len(line) && isPunct(line[i+1]) {
+				emit(line[i+1 : i+2])
+				i += 2
+				continue
+			}
+
+		case '`':
+			ticks := line[i : i+run(line[i:], '`')]
+			if strings.Contains(line[i+len(ticks):], ticks) {
+				s.code = ticks
+				i += len(ticks)
+				continue
+			}
+			if !final {
+				return nil, 0, false
+			}
+			emit(ticks)
+			i += len(ticks)
+			continue
+
+		case '*', '_', '~':
+			n := run(line[i:], c)
+			d := min(n, 2)
+			if c == '~' && n != 2 {
+				emit(line[i : i+n])
+				i += n
+				continue
+			}
+
+			on := &s.italic
+			if c == '~' {
+				on = &s.strike
+			} else if d == 2 {
+				on = &s.bold
+			}
+
+			prev, _ := utf8.DecodeLastRuneInString(line[:i])
+			if i == 0 {
+				prev = ' '
+			}
+			if i+d == len(line) && !final {
+				return nil, 0, false
+			}
+			next, _ := utf8.DecodeRuneInString(line[i+d:])
+			if i+d == len(line) {
+				next = ' '
+			}
+
+			if *on {
+				if !unicode.IsSpace(prev) && (c != '_' || !isAlnum(next)) {
+					*on = false
+					i += d
+					continue
+				}
+			} else if !unicode.IsSpace(next) && (c != '_' || !isAlnum(prev)) {
+				if hasCloser(line[i+d:], c, d) {
+					*on = true
+					i += d
+					continue
+				}
+				if !final {
+					return nil, 0, false
+				}
+			}
+			emit(line[i : i+d])
+			i += d
+			continue
+
+		case '[':
+			if s.link {
+				break
+			}
+			text, url, state := parseLink(line[i:], final)
+			if state == linkIncomplete {
+				return nil, 0, false
+			}
+			if state == linkFound {
+				s.link, s.linkTxt, s.linkURL = true, text, url
+				i++
+				continue
+			}
+
+		case ']':
+			if !s.link {
+				break
+			}
+			// the URL was found with the text, so it directly follows
+			i += len("](") + len(s.linkURL) + len(")")
+			s.link = false
+			if s.linkURL != s.linkTxt {
+				for _, c := range " (" + s.linkURL + ")" {
+					cells = append(cells, cell{text: string(c), sgr: base.ColorGray, width: runeWidth(c)})
+				}
+			}
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(line[i:])
+		emit(line[i : i+size])
+		i += size
+	}
+	return cells, max(i, end), true
+}
+
+// run returns the number of consecutive c at the beginning of s.
+func run(s string, c byte) int {
+	n := 0
+	for n < len(s) && s[n] == c {
+		n++
+	}
+	return n
+}
+
+// hasCloser reports whether there is a marker closing the emphasis in the rest of the line.
+func hasCloser(rest string, c byte, d int) bool {
+	marker := strings.Repeat(string(c), d)
+	for i := 1; i < len(rest); i++ {
+		if !strings.HasPrefix(rest[i:], marker) || rest[i-1] == ' ' {
+			continue
+		}
+		if c == '_' {
+			next, _ := utf8.DecodeRuneInString(rest[i+d:])
+			if i+d < len(rest) && isAlnum(next) {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+const (
+	linkNone = iota
+	linkFound
+	linkIncomplete
+)
+
+// parseLink parses the link at the beginning of s, e.g. [text](url).
+func parseLink(s string, final bool) (text string, url string, state int) {
+	incomplete := linkIncomplete
+	if final {
+		incomplete = linkNone
+	}
+
+	closing := strings.IndexByte(s, ']')
+	if closing < 0 || closing+1 == len(s) {
+		return "", "", incomplete
+	}
+	if s[closing+1] != '(' {
+		return "", "", linkNone
+	}
+
+	rest := s[closing+2:]
+	end := strings.IndexByte(rest, ')')
+	if end < 0 {
+		if strings.ContainsAny(rest, " \t") {
+			return "", "", linkNone
+		}
+		return "", "", incomplete
+	}
+	if strings.ContainsAny(rest[:end], " \t") {
+		return "", "", linkNone
+	}
+	return s[1:closing], rest[:end], linkFound
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isAlnum(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c)
+}
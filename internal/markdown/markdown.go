@@ -0,0 +1,443 @@
+// Package markdown renders Markdown for the terminal while it is being streamed, e.g. the answers of the AI.
+package markdown
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ruandada/aish/internal/base"
+)
+
+const defaultWidth = 80
+
+// Renderer renders the Markdown written to it as styled text. A line is rendered as soon as its kind
+// is known, and the words of headings, lists, quotes and paragraphs as soon as they are complete.
+// Tables and the lines of code blocks are rendered once they are complete.
+type Renderer struct {
+	w     io.Writer
+	width int
+	err   error
+
+	// the current source line, which is not terminated yet
+	line string
+	// whether the prefix of the current line, e.g. a bullet, is written
+	started bool
+	// the bytes of the current line which are rendered
+	consumed int
+	// the style of the text of the current line, and the state of its inline markers
+	style  string
+	inline inlineState
+
+	// written at the beginning of the wrapped lines
+	indent      []cell
+	indentWidth int
+	// the column of the cursor, and the style of the text written at it
+	col int
+	sgr string
+
+	// the blank lines held back, so that the output never ends with one
+	blank int
+	wrote bool
+
+	fence *fence
+	table []string
+}
+
+// fence is the code block being rendered.
+type fence struct {
+	marker string
+	lang   *language
+	// whether a block comment is open at the end of the previous line
+	comment bool
+}
+
+// NewRenderer creates a renderer writing to w, which wraps the text at the given width, or at 80 columns when it is not positive.
+func NewRenderer(w io.Writer, width int) *Renderer {
+	if width <= 0 {
+		width = defaultWidth
+	}
+	return &Renderer{w: w, width: width}
+}
+
+func (r *Renderer) Write(p []byte) (int, error) {
+	r.line += string(p)
+	for {
+		i := strings.IndexByte(r.line, '\n')
+		if i < 0 {
+			break
+		}
+		line := r.line[:i]
+		r.line = r.line[i+1:]
+		r.endLine(strings.TrimSuffix(line, "\r"))
+	}
+	r.renderPartialLine()
+	return len(p), r.err
+}
+
+// Close renders the rest of the text, it leaves the cursor at the beginning of a line.
+func (r *Renderer) Close() error {
+	if r.line != "" {
+		line := r.line
+		r.line = ""
+		r.endLine(line)
+	}
+	r.flushTable()
+	return r.err
+}
+
+// write writes the text as is, after resetting the style.
+func (r *Renderer) write(s string) {
+	if r.sgr != "" {
+		r.sgr = ""
+		r.write(base.ColorReset)
+	}
+	if r.err != nil || s == "" {
+		return
+	}
+	_, r.err = io.WriteString(r.w, s)
+	r.wrote = true
+}
+
+// writeCells writes the styled text, the style is only changed when it differs.
+func (r *Renderer) writeCells(cells []cell) {
+	var sb strings.Builder
+	sgr := r.sgr
+	for _, c := range cells {
+		if c.sgr != sgr {
+			if sgr != "" {
+				sb.WriteString(base.ColorReset)
+			}
+			sb.WriteString(c.sgr)
+			sgr = c.sgr
+		}
+		sb.WriteString(c.text)
+	}
+	r.sgr = ""
+	r.write(sb.String())
+	r.sgr = sgr
+}
+
+// flushBlank writes a blank line held back before the next content, consecutive ones are collapsed.
+func (r *Renderer) flushBlank() {
+	if r.blank > 0 && r.wrote {
+		r.write("\n")
+	}
+	r.blank = 0
+}
+
+// renderPartialLine renders what is known of the current line, as long as its kind is known.
+func (r *Renderer) renderPartialLine() {
+	if r.fence != nil || r.line == "" {
+		return
+	}
+	if !r.started {
+		if !isStreamable(r.line) {
+			return
+		}
+		r.flushTable()
+		r.startLine(r.line)
+	}
+	r.renderWords(r.line, false)
+}
+
+func (r *Renderer) endLine(line string) {
+	if r.fence != nil {
+		r.renderCodeLine(line)
+		return
+	}
+
+	if !r.started {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "|") {
+			r.table = append(r.table, trimmed)
+			return
+		}
+		r.flushTable()
+
+		switch {
+		case trimmed == "":
+			r.blank++
+			return
+		case isFence(trimmed):
+			r.flushBlank()
+			r.startFence(trimmed)
+			return
+		case isRule(trimmed):
+			r.flushBlank()
+			r.write(base.ColorGray + strings.Repeat("─", r.width) + base.ColorReset + "\n")
+			return
+		}
+		r.startLine(line)
+	}
+
+	r.renderWords(line, true)
+	r.write("\n")
+
+	r.started = false
+	r.consumed = 0
+	r.inline = inlineState{}
+	r.col = 0
+}
+
+// isStreamable reports whether the kind of a partial line is known, and it can be rendered word by word.
+func isStreamable(line string) bool {
+	trimmed := strings.TrimLeft(line, " \t")
+	first, _, ok := strings.Cut(trimmed, " ")
+	if !ok || first == "" {
+		return false
+	}
+	// a fence, a table row or a rule is rendered once it is complete
+	if strings.HasPrefix(first, "```") || strings.HasPrefix(first, "~~~") || strings.HasPrefix(first, "|") {
+		return false
+	}
+	// a task list item is known once its box is complete
+	if marker := listMarker(trimmed); marker != "" {
+		if box := trimmed[len(marker):]; len(box) < 4 && strings.HasPrefix(box, "[") {
+			return false
+		}
+	}
+	return strings.Trim(trimmed, "-*_ ") != ""
+}
+
+func isFence(trimmed string) bool {
+	return strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")
+}
+
+func isRule(trimmed string) bool {
+	s := strings.ReplaceAll(trimmed, " ", "")
+	if len(s) < 3 {
+		return false
+	}
+	return strings.Count(s, s[:1]) == len(s) && strings.Contains("-*_", s[:1])
+}
+
+// startLine writes the prefix of a line according to its kind, and sets the style of its text.
+func (r *Renderer) startLine(line string) {
+	r.flushBlank()
+	r.started = true
+	r.style = base.ColorGray
+	r.indent = nil
+
+	n := len(line) - len(strings.TrimLeft(line, " \t"))
+	pad := strings.ReplaceAll(line[:n], "\t", "    ")
+	rest := line[n:]
+	r.consumed = n
+
+	if level := headingLevel(rest); level > 0 {
+		r.consumed += level
+		switch level {
+		case 1:
+			r.style = base.ColorPurple + base.Bold + base.Underline
+		case 2:
+			r.style = base.ColorPurple + base.Bold
+		default:
+			r.style = base.ColorBlue + base.Bold
+		}
+		r.setIndent(pad)
+		r.writeCells(r.indent)
+		r.col = r.indentWidth
+		return
+	}
+
+	if marker := listMarker(rest); marker != "" {
+		r.consumed += len(marker)
+		bullet := marker
+		if strings.ContainsAny(marker[:1], "-*+") {
+			bullet = "• "
+		}
+		// a task list item
+		if box := rest[len(marker):]; len(box) >= 4 && box[0] == '[' && box[2] == ']' && box[3] == ' ' {
+			switch box[1] {
+			case ' ':
+				bullet += "☐ "
+				r.consumed += 4
+			case 'x', 'X':
+				bullet += "☑ "
+				r.consumed += 4
+			}
+		}
+		r.writeCells([]cell{{text: pad}})
+		r.writeCells([]cell{{text: bullet, sgr: base.ColorCyan}})
+		r.setIndent(pad + strings.Repeat(" ", stringWidth(bullet)))
+		r.col = r.indentWidth
+		return
+	}
+
+	if strings.HasPrefix(rest, ">") {
+		r.consumed++
+		r.style = base.ColorGray + base.Italic
+		r.indent = []cell{{text: pad}, {text: "│ ", sgr: base.ColorGray}}
+		r.indentWidth = stringWidth(pad) + 2
+		r.writeCells(r.indent)
+		r.col = r.indentWidth
+		return
+	}
+
+	r.setIndent(pad)
+	r.writeCells(r.indent)
+	r.col = r.indentWidth
+}
+
+func (r *Renderer) setIndent(pad string) {
+	r.indent = []cell{{text: pad}}
+	r.indentWidth = stringWidth(pad)
+}
+
+func headingLevel(s string) int {
+	level := len(s) - len(strings.TrimLeft(s, "#"))
+	if level == 0 || level > 6 || !strings.HasPrefix(s[level:], " ") {
+		return 0
+	}
+	return level
+}
+
+// listMarker returns the marker of a list item with the following space, e.g. "- " or "1. ".
+func listMarker(s string) string {
+	if len(s) >= 2 && strings.ContainsAny(s[:1], "-*+") && s[1] == ' ' {
+		return s[:2]
+	}
+	digits := len(s) - len(strings.TrimLeft(s, "0123456789"))
+	if digits == 0 || digits > 9 || len(s) < digits+2 {
+		return ""
+	}
+	if (s[digits] == '.' || s[digits] == ')') && s[digits+1] == ' ' {
+		return s[:digits+2]
+	}
+	return ""
+}
+
+// renderWords renders the complete words of the line which are not rendered yet, wrapping them at the width.
+func (r *Renderer) renderWords(line string, final bool) {
+	for {
+		text := line[r.consumed:]
+		space := len(text) - len(strings.TrimLeft(text, " \t"))
+		if space == len(text) {
+			if final {
+				r.consumed = len(line)
+			}
+			return
+		}
+
+		end, ok := wordEnd(text, space, final)
+		if !ok {
+			return
+		}
+
+		state := r.inline
+		cells, next, ok := state.render(line, r.consumed+space, r.consumed+end, final, r.style)
+		if !ok {
+			return
+		}
+		r.inline = state
+		r.consumed = next
+		r.place(cells, space > 0)
+	}
+}
+
+// wordEnd returns the end of the word starting at start, a word ends before a space, or after a wide
+// character, e.g. a CJK one, followed by another character which is not a marker.
+func wordEnd(text string, start int, final bool) (int, bool) {
+	for i := start; i < len(text); {
+		c, size := utf8.DecodeRuneInString(text[i:])
+		if c == utf8.RuneError && !utf8.FullRuneInString(text[i:]) {
+			return 0, final && i > start
+		}
+		if c == ' ' || c == '\t' {
+			return i, true
+		}
+		i += size
+		if runeWidth(c) == 2 && i < len(text) && !strings.ContainsRune(markerChars+" \t", rune(text[i])) {
+			return i, true
+		}
+	}
+	return len(text), final
+}
+
+// place writes a word at the cursor, or on the next line if it does not fit.
+func (r *Renderer) place(cells []cell, space bool) {
+	width := cellsWidth(cells)
+	if r.col > r.indentWidth {
+		sep := 0
+		if space {
+			sep = 1
+		}
+		if r.col+sep+width > r.width {
+			r.newLine()
+		} else if space {
+			// the space keeps the style when it is within a styled text, e.g. a link
+			sgr := ""
+			if r.sgr == cells[0].sgr {
+				sgr = r.sgr
+			}
+			r.writeCells([]cell{{text: " ", sgr: sgr, width: 1}})
+			r.col++
+		}
+	}
+
+	// a word longer than a line is broken
+	for len(cells) > 0 {
+		n, w := 0, 0
+		for n < len(cells) && r.col+w+cells[n].width <= r.width {
+			w += cells[n].width
+			n++
+		}
+		if n == 0 && r.col == r.indentWidth {
+			n, w = 1, cells[0].width
+		}
+		r.writeCells(cells[:n])
+		r.col += w
+		cells = cells[n:]
+		if len(cells) > 0 {
+			r.newLine()
+		}
+	}
+}
+
+func (r *Renderer) newLine() {
+	r.write("\n")
+	r.writeCells(r.indent)
+	r.col = r.indentWidth
+}
+
+func (r *Renderer) startFence(trimmed string) {
+	marker := trimmed[:3]
+	lang := strings.TrimSpace(strings.TrimLeft(trimmed, marker[:1]))
+	if fields := strings.Fields(lang); len(fields) > 0 {
+		lang = fields[0]
+	}
+	r.fence = &fence{
+		marker: trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, marker[:1]))],
+		lang:   lookupLanguage(lang),
+	}
+	r.write(base.ColorGray + trimmed + base.ColorReset + "\n")
+}
+
+func (r *Renderer) renderCodeLine(line string) {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, r.fence.marker) && strings.Trim(trimmed, r.fence.marker[:1]) == "" {
+		r.write(base.ColorGray + trimmed + base.ColorReset + "\n")
+		r.fence = nil
+		return
+	}
+	r.writeCells(r.fence.highlight(line))
+	r.write("\n")
+}
+
+// flushTable renders the table rows held back, as a table when the second one is a delimiter row.
+func (r *Renderer) flushTable() {
+	rows := r.table
+	r.table = nil
+	if len(rows) == 0 {
+		return
+	}
+	r.flushBlank()
+
+	if len(rows) < 2 || !isDelimiterRow(splitRow(rows[1])) {
+		for _, row := range rows {
+			r.write(base.ColorGray + row + base.ColorReset + "\n")
+		}
+		return
+	}
+	r.renderTable(rows)
+}
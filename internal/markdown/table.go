@@ -0,0 +1,177 @@
+package markdown
+
+import (
+	"strings"
+
+	"github.com/ruandada/aish/internal/base"
+)
+
+// the narrowest a column is shrunk to when the table is wider than the terminal
+const minColumnWidth = 3
+
+type alignment int
+
+const (
+	alignLeft alignment = iota
+	alignCenter
+	alignRight
+)
+
+// splitRow returns the cells of a table row, e.g. "| a | b |".
+func splitRow(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, "\\|") {
+		row = row[:len(row)-1]
+	}
+
+	var cells []string
+	var sb strings.Builder
+	for i := 0; i < len(row); i++ {
+		switch {
+		case row[i] == '\\' && i+1 < len(row) && row[i+1] == '|':
+			sb.WriteByte('|')
+			i++
+		case row[i] == '|':
+			cells = append(cells, strings.TrimSpace(sb.String()))
+			sb.Reset()
+		default:
+			sb.WriteByte(row[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(sb.String()))
+}
+
+// isDelimiterRow reports whether the cells are the row between the header and the body, e.g. "|---|:-:|".
+func isDelimiterRow(cells []string) bool {
+	for _, c := range cells {
+		c = strings.TrimSuffix(strings.TrimPrefix(c, ":"), ":")
+		if c == "" || strings.Trim(c, "-") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Renderer) renderTable(rows []string) {
+	header := splitRow(rows[0])
+	n := len(header)
+
+	aligns := make([]alignment, n)
+	for i, c := range splitRow(rows[1]) {
+		if i >= n {
+			break
+		}
+		switch {
+		case strings.HasPrefix(c, ":") && strings.HasSuffix(c, ":"):
+			aligns[i] = alignCenter
+		case strings.HasSuffix(c, ":"):
+			aligns[i] = alignRight
+		}
+	}
+
+	grid := make([][][]cell, 0, len(rows)-1)
+	widths := make([]int, n)
+	for i, row := range append([]string{rows[0]}, rows[2:]...) {
+		style := base.ColorGray
+		if i == 0 {
+			style = base.ColorWhite + base.Bold
+		}
+
+		texts := splitRow(row)
+		cells := make([][]cell, n)
+		for j := range cells {
+			if j >= len(texts) {
+				continue
+			}
+			state := inlineState{}
+			cells[j], _, _ = state.render(texts[j], 0, len(texts[j]), true, style)
+			widths[j] = max(widths[j], cellsWidth(cells[j]))
+		}
+		grid = append(grid, cells)
+	}
+
+	// shrink the widest columns until the table fits in the terminal
+	for {
+		total := 3*n + 1
+		widest := 0
+		for j, w := range widths {
+			total += w
+			if w > widths[widest] {
+				widest = j
+			}
+		}
+		if total <= r.width || widths[widest] <= minColumnWidth {
+			break
+		}
+		widths[widest]--
+	}
+
+	border := func(left string, middle string, right string) {
+		parts := make([]string, n)
+		for j, w := range widths {
+			parts[j] = strings.Repeat("─", w+2)
+		}
+		r.write(base.ColorGray + left + strings.Join(parts, middle) + right + base.ColorReset + "\n")
+	}
+
+	separator := cell{text: " │ ", sgr: base.ColorGray, width: 3}
+	border("┌", "┬", "┐")
+	for i, cells := range grid {
+		line := []cell{{text: "│ ", sgr: base.ColorGray, width: 2}}
+		for j, c := range cells {
+			if j > 0 {
+				line = append(line, separator)
+			}
+			line = append(line, alignCells(truncateCells(c, widths[j]), widths[j], aligns[j])...)
+		}
+		line = append(line, cell{text: " │", sgr: base.ColorGray, width: 2})
+		r.writeCells(line)
+		r.write("\n")
+
+		if i == 0 {
+			border("├", "┼", "┤")
+		}
+	}
+	border("└", "┴", "┘")
+}
+
+// truncateCells truncates the text to the width, with an ellipsis.
+func truncateCells(cells []cell, width int) []cell {
+	if cellsWidth(cells) <= width {
+		return cells
+	}
+	w := 0
+	for i, c := range cells {
+		if w+c.width > width-1 {
+			return append(cells[:i:i], cell{text: "…", sgr: c.sgr, width: 1})
+		}
+		w += c.width
+	}
+	return cells
+}
+
+func alignCells(cells []cell, width int, align alignment) []cell {
+	space := width - cellsWidth(cells)
+	if space <= 0 {
+		return cells
+	}
+
+	left := 0
+	switch align {
+	case alignCenter:
+		left = space / 2
+	case alignRight:
+		left = space
+	}
+
+	aligned := make([]cell, 0, len(cells)+2)
+	if left > 0 {
+		aligned = append(aligned, cell{text: strings.Repeat(" ", left), width: left})
+	}
+	aligned = append(aligned, cells...)
+	if right := space - left; right > 0 {
+		aligned = append(aligned, cell{text: strings.Repeat(" ", right), width: right})
+	}
+	return aligned
+}
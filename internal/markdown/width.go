@@ -0,0 +1,56 @@
+package markdown
+
+import "unicode"
+
+// the ranges of the characters taking two columns, e.g. CJK ones and emojis
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F},
+	{0x2E80, 0x303E},
+	{0x3041, 0x33FF},
+	{0x3400, 0x4DBF},
+	{0x4E00, 0x9FFF},
+	{0xA000, 0xA4CF},
+	{0xAC00, 0xD7A3},
+	{0xF900, 0xFAFF},
+	{0xFE30, 0xFE4F},
+	{0xFF00, 0xFF60},
+	{0xFFE0, 0xFFE6},
+	{0x1F300, 0x1F64F},
+	{0x1F900, 0x1F9FF},
+	{0x20000, 0x3FFFD},
+}
+
+// runeWidth returns the number of columns taken by c in a terminal.
+func runeWidth(c rune) int {
+	if c < 0x1100 {
+		if unicode.Is(unicode.Mn, c) || unicode.IsControl(c) {
+			return 0
+		}
+		return 1
+	}
+	if unicode.Is(unicode.Mn, c) {
+		return 0
+	}
+	for _, r := range wideRanges {
+		if c >= r[0] && c <= r[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+func stringWidth(s string) int {
+	width := 0
+	for _, c := range s {
+		width += runeWidth(c)
+	}
+	return width
+}
+
+func cellsWidth(cells []cell) int {
+	width := 0
+	for _, c := range cells {
+		width += c.width
+	}
+	return width
+}
@@ -0,0 +1,209 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ruandada/aish/internal/jsonrpc"
+)
+
+// time allowed for a server to start and answer the handshake
+const startTimeout = 10 * time.Second
+
+// Client is a connection to an MCP server running as a child process.
+type Client struct {
+	name    string
+	command []string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	conn    *jsonrpc.Conn
+
+	info      InitializeResult
+	tools     []Tool
+	resources []Resource
+}
+
+// Start launches the server, performs the handshake, and lists its tools and resources.
+func Start(ctx context.Context, name string, command []string, dir string, environ []string) (*Client, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("%s: empty command", name)
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = environ
+	// the logs of the server are only shown when it fails to start
+	stderr := &tailBuffer{limit: 2048}
+	cmd.Stderr = stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	c := &Client{
+		name:    name,
+		command: command,
+		cmd:     cmd,
+		stdin:   stdin,
+	}
+	c.conn = jsonrpc.NewConn(stdout, stdin, c.handle)
+	go c.conn.Run(context.Background())
+
+	ctx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+	if err := c.initialize(ctx); err != nil {
+		if exitErr := c.Close(); exitErr != nil && errors.Is(err, jsonrpc.ErrClosed) {
+			err = fmt.Errorf("server exited: %w", exitErr)
+		}
+		if logs := strings.TrimSpace(stderr.String()); logs != "" {
+			return nil, fmt.Errorf("%s: %w\n%s", name, err, logs)
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return c, nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	if err := c.conn.Call(ctx, MethodInitialize, InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      Implementation{Name: "aish", Version: "1.0.0"},
+	}, &c.info); err != nil {
+		return err
+	}
+	if err := c.conn.Notify(MethodInitialized, nil); err != nil {
+		return err
+	}
+
+	if c.info.Capabilities.Tools != nil {
+		cursor := ""
+		for {
+			result := ListToolsResult{}
+			if err := c.conn.Call(ctx, MethodToolsList, ListParams{Cursor: cursor}, &result); err != nil {
+				return err
+			}
+			c.tools = append(c.tools, result.Tools...)
+			if cursor = result.NextCursor; cursor == "" {
+				break
+			}
+		}
+	}
+
+	if c.info.Capabilities.Resources != nil {
+		cursor := ""
+		for {
+			result := ListResourcesResult{}
+			if err := c.conn.Call(ctx, MethodResourcesList, ListParams{Cursor: cursor}, &result); err != nil {
+				return err
+			}
+			c.resources = append(c.resources, result.Resources...)
+			if cursor = result.NextCursor; cursor == "" {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// handle answers the requests sent by the server, only pings are supported.
+func (c *Client) handle(ctx context.Context, conn *jsonrpc.Conn, req *jsonrpc.Request) (any, error) {
+	if req.Method == MethodPing {
+		return struct{}{}, nil
+	}
+	return nil, jsonrpc.NewError(jsonrpc.CodeMethodNotFound, "method not found: %s", req.Method)
+}
+
+func (c *Client) Name() string {
+	return c.name
+}
+
+func (c *Client) Command() []string {
+	return c.command
+}
+
+func (c *Client) ServerInfo() Implementation {
+	return c.info.ServerInfo
+}
+
+func (c *Client) Instructions() string {
+	return c.info.Instructions
+}
+
+func (c *Client) Tools() []Tool {
+	return c.tools
+}
+
+func (c *Client) Resources() []Resource {
+	return c.resources
+}
+
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]any) (*CallToolResult, error) {
+	result := &CallToolResult{}
+	if err := c.conn.Call(ctx, MethodToolsCall, CallToolParams{Name: name, Arguments: arguments}, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) ReadResource(ctx context.Context, uri string) (*ReadResourceResult, error) {
+	result := &ReadResourceResult{}
+	if err := c.conn.Call(ctx, MethodResourcesRead, ReadResourceParams{URI: uri}, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Close closes the stdin of the server to ask it to exit, and kills it if it does not in time.
+func (c *Client) Close() error {
+	c.stdin.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(2 * time.Second):
+		c.cmd.Process.Kill()
+		return <-done
+	}
+}
+
+// tailBuffer keeps the last bytes written to it.
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	buf   []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if n := len(b.buf); n > b.limit {
+		b.buf = b.buf[n-b.limit:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
@@ -0,0 +1,108 @@
+package mcp
+
+import (
+	"context"
+	"io"
+
+	"github.com/ruandada/aish/internal/jsonrpc"
+)
+
+type ToolHandler func(ctx context.Context, arguments map[string]any) (*CallToolResult, error)
+
+type ResourceReader func(ctx context.Context) (*ResourceContents, error)
+
+// Server serves tools and resources to an MCP client.
+type Server struct {
+	info Implementation
+
+	tools        []Tool
+	toolHandlers map[string]ToolHandler
+
+	resources       []Resource
+	resourceReaders map[string]ResourceReader
+}
+
+func NewServer(name string, version string) *Server {
+	return &Server{
+		info:            Implementation{Name: name, Version: version},
+		tools:           []Tool{},
+		resources:       []Resource{},
+		toolHandlers:    make(map[string]ToolHandler),
+		resourceReaders: make(map[string]ResourceReader),
+	}
+}
+
+func (s *Server) AddTool(tool Tool, handler ToolHandler) {
+	s.tools = append(s.tools, tool)
+	s.toolHandlers[tool.Name] = handler
+}
+
+func (s *Server) AddResource(resource Resource, reader ResourceReader) {
+	s.resources = append(s.resources, resource)
+	s.resourceReaders[resource.URI] = reader
+}
+
+// Serve handles the requests read from reader until it is exhausted.
+func (s *Server) Serve(ctx context.Context, reader io.Reader, writer io.Writer) error {
+	return jsonrpc.NewConn(reader, writer, s.handle).Run(ctx)
+}
+
+func (s *Server) handle(ctx context.Context, conn *jsonrpc.Conn, req *jsonrpc.Request) (any, error) {
+	switch req.Method {
+	case MethodInitialize:
+		return InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities: ServerCapabilities{
+				Tools:     &struct{}{},
+				Resources: &struct{}{},
+			},
+			ServerInfo: s.info,
+		}, nil
+
+	case MethodInitialized:
+		return nil, nil
+
+	case MethodPing:
+		return struct{}{}, nil
+
+	case MethodToolsList:
+		return ListToolsResult{Tools: s.tools}, nil
+
+	case MethodToolsCall:
+		params := CallToolParams{}
+		if err := req.BindParams(&params); err != nil {
+			return nil, err
+		}
+		handler, ok := s.toolHandlers[params.Name]
+		if !ok {
+			return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "unknown tool: %s", params.Name)
+		}
+		result, err := handler(ctx, params.Arguments)
+		if err != nil {
+			// errors of tools are reported in the result, so that the model can see them
+			return &CallToolResult{Content: []Content{TextContent(err.Error())}, IsError: true}, nil
+		}
+		return result, nil
+
+	case MethodResourcesList:
+		return ListResourcesResult{Resources: s.resources}, nil
+
+	case MethodResourcesRead:
+		params := ReadResourceParams{}
+		if err := req.BindParams(&params); err != nil {
+			return nil, err
+		}
+		reader, ok := s.resourceReaders[params.URI]
+		if !ok {
+			return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "unknown resource: %s", params.URI)
+		}
+		contents, err := reader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return ReadResourceResult{Contents: []ResourceContents{*contents}}, nil
+
+	default:
+		return nil, jsonrpc.NewError(jsonrpc.CodeMethodNotFound, "method not found: %s", req.Method)
+	}
+}
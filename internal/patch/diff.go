@@ -0,0 +1,224 @@
+// Package patch computes the differences between texts and applies unified diffs.
+package patch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the most edits searched by Diff, the differences of texts edited further are not computed
+const maxEditDistance = 2000
+
+// Op is the kind of a line of a diff.
+type Op byte
+
+const (
+	OpEqual  Op = ' '
+	OpDelete Op = '-'
+	OpInsert Op = '+'
+)
+
+// Edit is a line of a diff.
+type Edit struct {
+	Op   Op
+	Text string
+}
+
+// SplitLines returns the lines of a text, without their line breaks.
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Diff returns the shortest edits from a to b, with Myers' algorithm. It returns false when
+// the texts differ too much for the edits to be computed.
+func Diff(a []string, b []string) ([]Edit, bool) {
+	// the common prefix and suffix are not searched
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	middle, ok := myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	if !ok {
+		return nil, false
+	}
+
+	edits := make([]Edit, 0, prefix+len(middle)+suffix)
+	for _, line := range a[:prefix] {
+		edits = append(edits, Edit{Op: OpEqual, Text: line})
+	}
+	edits = append(edits, middle...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{Op: OpEqual, Text: line})
+	}
+	return edits, true
+}
+
+func myers(a []string, b []string) ([]Edit, bool) {
+	n, m := len(a), len(b)
+	if n+m == 0 {
+		return nil, true
+	}
+
+	// v[k+offset] is the furthest x reached on the diagonal k, trace[d] keeps the diagonals -d..d
+	// of v before the step d, which are the ones the step reads
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+
+	for d := 0; d <= min(n+m, maxEditDistance); d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[k-1+offset] < v[k+1+offset] {
+				x = v[k+1+offset]
+			} else {
+				x = v[k-1+offset] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+offset] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, d), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// backtrack walks the trace of myers back from the end, to return the edits in order.
+func backtrack(a []string, b []string, trace [][]int, d int) []Edit {
+	var edits []Edit
+	x, y := len(a), len(b)
+
+	for ; d > 0; d-- {
+		// the furthest x reached on the diagonal k before the step d
+		furthest := func(k int) int {
+			return trace[d][k+d]
+		}
+		k := x - y
+
+		var prevK int
+		if k == -d || k != d && furthest(k-1) < furthest(k+1) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := furthest(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, Edit{Op: OpEqual, Text: a[x]})
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, Edit{Op: OpInsert, Text: b[y]})
+		} else {
+			x--
+			edits = append(edits, Edit{Op: OpDelete, Text: a[x]})
+		}
+	}
+	for x > 0 {
+		x--
+		edits = append(edits, Edit{Op: OpEqual, Text: a[x]})
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// Hunk is a group of edits, with the lines around them.
+type Hunk struct {
+	// the first line of the hunk in the old and the new text, from 1
+	OldStart int
+	NewStart int
+	Edits    []Edit
+}
+
+// Header returns the header of the hunk in a unified diff, e.g. "@@ -1,3 +1,4 @@".
+func (h *Hunk) Header() string {
+	oldLines, newLines := 0, 0
+	for _, e := range h.Edits {
+		if e.Op != OpInsert {
+			oldLines++
+		}
+		if e.Op != OpDelete {
+			newLines++
+		}
+	}
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, oldLines), hunkRange(h.NewStart, newLines))
+}
+
+func hunkRange(start int, lines int) string {
+	if lines == 0 {
+		// an empty range starts before its position
+		start--
+	}
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// Hunks groups the edits into hunks with the given number of lines of context.
+func Hunks(edits []Edit, context int) []*Hunk {
+	// the lines of the old and the new text at each edit
+	oldLines, newLines := make([]int, len(edits)), make([]int, len(edits))
+	var changes []int
+	oldLine, newLine := 1, 1
+	for i, e := range edits {
+		oldLines[i], newLines[i] = oldLine, newLine
+		if e.Op != OpInsert {
+			oldLine++
+		}
+		if e.Op != OpDelete {
+			newLine++
+		}
+		if e.Op != OpEqual {
+			changes = append(changes, i)
+		}
+	}
+
+	var hunks []*Hunk
+	for len(changes) > 0 {
+		// the changes close enough to share their context are in the same hunk
+		n := 1
+		for n < len(changes) && changes[n]-changes[n-1] <= 2*context+1 {
+			n++
+		}
+		start, end := max(changes[0]-context, 0), min(changes[n-1]+context+1, len(edits))
+		hunks = append(hunks, &Hunk{OldStart: oldLines[start], NewStart: newLines[start], Edits: edits[start:end]})
+		changes = changes[n:]
+	}
+	return hunks
+}
+
+// Unified returns the unified diff of the hunks of a file.
+func Unified(oldName string, newName string, hunks []*Hunk) string {
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for _, hunk := range hunks {
+		sb.WriteString(hunk.Header() + "\n")
+		for _, e := range hunk.Edits {
+			sb.WriteByte(byte(e.Op))
+			sb.WriteString(e.Text + "\n")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,265 @@
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DevNull is the name of the missing side of a created or deleted file.
+const DevNull = "/dev/null"
+
+// FilePatch is the part of a unified diff changing a file.
+type FilePatch struct {
+	// the names of the file before and after the change, DevNull when it is created or deleted
+	OldName string
+	NewName string
+	Hunks   []*Hunk
+	// whether the old and the new text end without a newline, as told by "\ No newline at end of file"
+	OldNoFinalNewline bool
+	NewNoFinalNewline bool
+}
+
+// Path returns the name of the file the patch applies to.
+func (p *FilePatch) Path() string {
+	if p.NewName == DevNull {
+		return p.OldName
+	}
+	return p.NewName
+}
+
+// IsCreation reports whether the patch creates the file.
+func (p *FilePatch) IsCreation() bool {
+	return p.OldName == DevNull
+}
+
+// IsDeletion reports whether the patch deletes the file.
+func (p *FilePatch) IsDeletion() bool {
+	return p.NewName == DevNull
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Parse parses a unified diff, which may change several files.
+func Parse(diff string) ([]*FilePatch, error) {
+	var patches []*FilePatch
+	var patch *FilePatch
+	var hunk *Hunk
+	// the lines of the old and the new text the hunk still has to read
+	oldLeft, newLeft := 0, 0
+
+	lines := SplitLines(strings.ReplaceAll(diff, "\r\n", "\n"))
+	for i, line := range lines {
+		if strings.HasPrefix(line, `\`) {
+			// "\ No newline at end of file" follows the last line of the old or the new text
+			if hunk != nil && len(hunk.Edits) > 0 {
+				switch hunk.Edits[len(hunk.Edits)-1].Op {
+				case OpDelete:
+					patch.OldNoFinalNewline = true
+				case OpInsert:
+					patch.NewNoFinalNewline = true
+				default:
+					patch.OldNoFinalNewline = true
+					patch.NewNoFinalNewline = true
+				}
+			}
+			continue
+		}
+		if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+			op := OpEqual
+			text := line
+			if line != "" {
+				op, text = Op(line[0]), line[1:]
+			}
+			switch {
+			case op == OpEqual && oldLeft > 0 && newLeft > 0:
+				oldLeft--
+				newLeft--
+			case op == OpDelete && oldLeft > 0:
+				oldLeft--
+			case op == OpInsert && newLeft > 0:
+				newLeft--
+			default:
+				return nil, fmt.Errorf("line %d: unexpected line in hunk %q: %q", i+1, hunk.Header(), line)
+			}
+			hunk.Edits = append(hunk.Edits, Edit{Op: op, Text: text})
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			patch = &FilePatch{OldName: fileName(line[4:])}
+			patches = append(patches, patch)
+			hunk = nil
+
+		case strings.HasPrefix(line, "+++ "):
+			if patch == nil || patch.NewName != "" {
+				return nil, fmt.Errorf("line %d: \"+++\" without \"---\"", i+1)
+			}
+			patch.NewName = fileName(line[4:])
+
+		case strings.HasPrefix(line, "@@"):
+			if patch == nil || patch.NewName == "" {
+				return nil, fmt.Errorf("line %d: hunk without file names", i+1)
+			}
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: invalid hunk header: %q", i+1, line)
+			}
+			oldStart, _ := strconv.Atoi(m[1])
+			newStart, _ := strconv.Atoi(m[3])
+			oldLeft, newLeft = 1, 1
+			if m[2] != "" {
+				oldLeft, _ = strconv.Atoi(m[2])
+			}
+			if m[4] != "" {
+				newLeft, _ = strconv.Atoi(m[4])
+			}
+			// an empty range starts before its position
+			if oldLeft == 0 {
+				oldStart++
+			}
+			if newLeft == 0 {
+				newStart++
+			}
+			hunk = &Hunk{OldStart: oldStart, NewStart: newStart}
+			patch.Hunks = append(patch.Hunks, hunk)
+
+		default:
+			// e.g. "diff --git" or "index"
+		}
+	}
+
+	if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+		return nil, fmt.Errorf("hunk %q is truncated", hunk.Header())
+	}
+	if len(patches) == 0 {
+		return nil, errors.New("no file patch found, a unified diff starts with \"--- <file>\" and \"+++ <file>\"")
+	}
+	for _, p := range patches {
+		if len(p.Hunks) == 0 {
+			return nil, fmt.Errorf("%s: no hunk found", p.Path())
+		}
+	}
+	return patches, nil
+}
+
+// fileName returns the name of a file in a "---" or "+++" line, without the "a/" or "b/" prefix of git and the timestamp.
+func fileName(s string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == DevNull {
+		return s
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		return s[2:]
+	}
+	return s
+}
+
+// HunkError tells why a hunk did not apply.
+type HunkError struct {
+	// the index of the hunk in the file patch, from 1
+	Index  int
+	Header string
+	Reason string
+}
+
+func (e *HunkError) Error() string {
+	return fmt.Sprintf("hunk #%d %s didn't apply: %s", e.Index, e.Header, e.Reason)
+}
+
+// Apply applies the hunks to the text of the file and returns the new text.
+// The hunks are searched around their line if the file changed, but their context must match exactly.
+// The new text keeps the line breaks of the file, and its final newline unless the patch changes it.
+func (p *FilePatch) Apply(text string) (string, error) {
+	eol := "\n"
+	if i := strings.IndexByte(text, '\n'); i > 0 && text[i-1] == '\r' {
+		eol = "\r\n"
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	finalNewline := text == "" || strings.HasSuffix(text, "\n")
+	switch {
+	case p.NewNoFinalNewline:
+		finalNewline = false
+	case p.OldNoFinalNewline:
+		finalNewline = true
+	}
+
+	lines := SplitLines(text)
+	result := make([]string, 0, len(lines))
+	// the next line of the old text which is not copied to the result
+	next := 0
+
+	for i, hunk := range p.Hunks {
+		var before, after []string
+		for _, e := range hunk.Edits {
+			if e.Op != OpInsert {
+				before = append(before, e.Text)
+			}
+			if e.Op != OpDelete {
+				after = append(after, e.Text)
+			}
+		}
+
+		at, ok := findLines(lines, before, next, hunk.OldStart-1)
+		if !ok {
+			return "", &HunkError{Index: i + 1, Header: hunk.Header(), Reason: mismatch(lines, before, max(hunk.OldStart-1, next))}
+		}
+		result = append(result, lines[next:at]...)
+		result = append(result, after...)
+		next = at + len(before)
+	}
+	result = append(result, lines[next:]...)
+
+	if len(result) == 0 {
+		return "", nil
+	}
+	if finalNewline {
+		result = append(result, "")
+	}
+	return strings.Join(result, eol), nil
+}
+
+// findLines returns where the lines are found in the text from the line from, the nearest to the line near.
+func findLines(text []string, lines []string, from int, near int) (int, bool) {
+	near = min(max(near, from), len(text))
+	if len(lines) == 0 {
+		return near, true
+	}
+	for delta := 0; near-delta >= from || near+delta < len(text); delta++ {
+		for _, at := range []int{near - delta, near + delta} {
+			if at >= from && at+len(lines) <= len(text) && linesEqual(text[at:at+len(lines)], lines) {
+				return at, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func linesEqual(a []string, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mismatch describes the first line of the context which differs from the text at the expected line.
+func mismatch(text []string, lines []string, at int) string {
+	for i, line := range lines {
+		if at+i >= len(text) {
+			return fmt.Sprintf("expected line %d to be %q, but the file has %d lines", at+i+1, line, len(text))
+		}
+		if text[at+i] != line {
+			return fmt.Sprintf("expected line %d to be %q, found %q, and the lines were not found elsewhere in the file",
+				at+i+1, line, text[at+i])
+		}
+	}
+	return "the lines overlap the previous hunk"
+}
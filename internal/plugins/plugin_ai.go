@@ -6,14 +6,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
+	"io"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 	"unicode"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/shared"
 	"github.com/ruandada/aish/internal/base"
+	"github.com/ruandada/aish/internal/markdown"
 	"mvdan.cc/sh/v3/interp"
 )
 
@@ -21,7 +27,17 @@ type ToolName string
 
 const (
 	ToolNameExecute           ToolName = "EXECUTE"
+	ToolNameRemember          ToolName = "REMEMBER"
+	ToolNameRecall            ToolName = "RECALL"
+	ToolNameForget            ToolName = "FORGET"
+	ToolNameDelegate          ToolName = "DELEGATE"
+	ToolNameReadOutput        ToolName = "READ_OUTPUT"
+	ToolNameReadFile          ToolName = "READ_FILE"
+	ToolNameWriteFile         ToolName = "WRITE_FILE"
+	ToolNameApplyPatch        ToolName = "APPLY_PATCH"
 	ToolNameUserDefinedPrefix ToolName = "TOOL_"
+	ToolNameMCPPrefix         ToolName = "MCP_"
+	ToolNameMCPReadResource   ToolName = "MCP_READ_RESOURCE"
 )
 
 //go:embed plugin_ai_system_prompt.tmpl
@@ -40,6 +56,14 @@ func init() {
 type AIPlugin struct {
 	client            *openai.Client
 	historyExecutions []*base.AIExecution
+	// the question whose turn reached the iteration limit, which can be continued by "aicontinue"
+	exhausted *base.AIExecution
+	// the full outputs of the tool calls, which are cut in the messages
+	outputs *outputStore
+	// the files changed by the AI in the current command line, as they were before
+	checkpoint *base.Checkpoint
+	// the commands whose output is withheld by .aiignore, until they are done
+	withheld sync.Map
 }
 
 var _ base.ShellPlugin = (*AIPlugin)(nil)
@@ -79,147 +103,253 @@ func isNotFoundError(err error) bool {
 
 // Execute implements base.ShellPlugin.
 func (a *AIPlugin) Execute(ce *base.CommandExecution, sce *base.SubCommandExecution, shell *base.Shell) (ok bool, err error) {
+	switch strings.ToLower(sce.Cmd()) {
+	case string(ExtensionCommandAITest):
+		return true, a.executeTest(ce, sce, shell)
+	case string(ExtensionCommandAIContinue):
+		return true, a.executeContinue(ce, sce, shell)
+	}
+
 	switch sce.Mode() {
 	case base.ShellModeAuto:
-		if err := sce.DefaultExecHandler(); err != nil {
-			if !isNotFoundError(err) {
+		c, err := a.classify(ce, sce, shell)
+		if err != nil {
+			return true, err
+		}
+		if c.natural {
+			a.indicateClassification(sce, c)
+		} else {
+			a.withholdOutput(ce, sce, shell)
+			if err := sce.DefaultExecHandler(); err == nil || !isNotFoundError(err) {
 				return true, err
 			}
-		} else {
-			return true, nil
+			a.takeWithheld(sce)
 		}
 	case base.ShellModeUser:
+		a.withholdOutput(ce, sce, shell)
 		return true, sce.DefaultExecHandler()
 	case base.ShellModeAI:
 	default:
 		return false, nil
 	}
 
-	qa := sce.QA()
-	iter := 0
-	iterLimit := a.iterationLimit()
-
-	for {
-		if iter > iterLimit {
-			iter--
-			break
-		}
+	opts, err := a.parseQuestionOptions(sce)
+	if err != nil {
+		return true, interp.ExitStatus(2)
+	}
 
-		messages, err := a.retrieveMessages(ce, shell, qa)
-		if err != nil {
-			return true, err
-		}
+	t := a.newTurn(ce, sce, shell, sce.QA())
+	a.startQuestion(t)
+	if opts.reasoningEffort != "" {
+		t.reasoningEffort = opts.reasoningEffort
+	}
+	if err := a.attachImages(t, opts.images); err != nil {
+		return true, err
+	}
+	if opts.json {
+		return true, a.executeJSON(t, opts)
+	}
 
-		stream := a.client.Chat.Completions.NewStreaming(
-			ce.Context(),
-			openai.ChatCompletionNewParams{
-				Model:    base.GetConfig(base.ConfigOpenAIModel),
-				Messages: messages,
-				Tools:    a.retrieveToolDefinitions(),
-			},
-			option.WithAPIKey(base.GetConfig(base.ConfigOpenAIAPIKey)),
-			option.WithBaseURL(base.GetConfig(base.ConfigOpenAIBaseURL)),
-		)
+	_, err = a.runTurn(t)
+	return true, err
+}
 
-		// optionally, an accumulator helper can be used
-		acc := openai.ChatCompletionAccumulator{}
+// runTurn runs the conversation loop of an AI turn, until the model gives an answer without tool calls
+// or the iteration limit is reached, and returns the final answer.
+func (a *AIPlugin) runTurn(t *aiTurn) (string, error) {
+	ce, qa := t.ce, t.qa
 
-		isLeadingSpace := true
-		hasToolCall := false
-		hasText := false
+	// the answers are not withheld, even if the command line has a command whose output is
+	withheld := ce.Withheld()
+	ce.SetWithheld(false)
+	defer ce.SetWithheld(withheld)
 
-		if sce.ColorSupported() {
-			fmt.Fprint(sce.Stdout(), base.ColorGray)
+	for iter := 0; iter <= t.iterLimit; iter++ {
+		messages, err := a.retrieveMessages(t)
+		if err != nil {
+			return "", err
 		}
-		for stream.Next() {
-			chunk := stream.Current()
-			acc.AddChunk(chunk)
 
-			if len(chunk.Choices) == 0 {
-				continue
-			}
+		answer, toolCall, err := a.stream(t, openai.ChatCompletionNewParams{
+			Model:           base.GetConfig(base.ConfigOpenAIModel),
+			Messages:        messages,
+			Tools:           t.tools,
+			ResponseFormat:  t.responseFormat,
+			ReasoningEffort: shared.ReasoningEffort(t.reasoningEffort),
+		})
+		if err != nil {
+			return "", err
+		}
 
-			text := chunk.Choices[0].Delta.Content
-			if isLeadingSpace {
-				text = strings.TrimLeftFunc(text, unicode.IsSpace)
-				if text == "" {
-					continue
-				}
-			}
-			isLeadingSpace = false
-			if text != "" {
-				hasText = true
-				sce.Stdout().Write([]byte(text))
-			}
+		if toolCall == nil {
+			return answer, nil
 		}
-		if sce.ColorSupported() {
-			fmt.Fprint(sce.Stdout(), base.ColorReset)
+
+		// Flush the leading answer text if it exists, and ensure the buffer is clean before handling the tool call
+		if answerText := a.truncateMessageText(ce.AnswerText()); answerText != "" {
+			qa.Answers = append(qa.Answers, base.AIAssistantAnswer{
+				Text:     answerText,
+				ToolCall: nil,
+			})
+			ce.Buffer().Reset()
 		}
 
-		if err := stream.Err(); err != nil {
-			if openaiErr, ok := err.(*openai.Error); ok {
-				if openaiErr.StatusCode == http.StatusUnauthorized {
-					if apiKey := base.GetConfig(base.ConfigOpenAIAPIKey); apiKey == "" {
-						fmt.Fprintln(sce.Stderr(), "Error: You haven't set the OpenAI API key, configure it by: aiset openai.api_key \"<your-api-key>\"")
-					} else {
-						fmt.Fprintln(sce.Stderr(), "Error: invalid OpenAI API key, review your configuration by: aiget")
-					}
-					return true, nil
-				}
+		started := time.Now()
+		t.toolCode, t.toolApproval, t.toolTimeout = "", "", 0
+		if err = a.assessToolCall(t, toolCall); err == nil {
+			err = a.handleToolCall(t, toolCall)
+		}
+		if err != nil {
+			// the answer may be recorded already, e.g. by a command cancelled by the user
+			if hasToolAnswer(qa, toolCall) {
+				// nothing to record
+			} else if answerText := a.toolOutputText(a.redactForAI(t.sce, t.shell, ce.AnswerText())); answerText != "" {
+				qa.Answers = append(qa.Answers, base.AIAssistantAnswer{
+					Text:     answerText,
+					ToolCall: toolCall,
+				})
+			} else {
+				qa.Answers = append(qa.Answers, base.AIAssistantAnswer{
+					Text:     fmt.Sprintf("Error: %s", err.Error()),
+					ToolCall: toolCall,
+				})
 			}
-			return true, err
 		}
-
-		if hasText {
-			sce.Stdout().Write([]byte("\n"))
+		a.inspectToolOutput(t, toolCall)
+		a.auditToolCall(t, toolCall, started, err)
+		if err != nil && (errors.Is(err, base.ErrInterrupted) || ce.Context().Err() != nil) {
+			ce.Buffer().Reset()
+			return "", base.ErrInterrupted
 		}
+		ce.Buffer().Reset()
+	}
+	return a.summarizeExhaustedTurn(t)
+}
 
-		if len(acc.Choices) > 0 {
-			choice := acc.Choices[0]
+// stream requests a chat completion and prints the answer while it is generated,
+// it returns the answer text and the tool call requested by the model if any.
+func (a *AIPlugin) stream(t *aiTurn, params openai.ChatCompletionNewParams) (string, *openai.ChatCompletionMessageToolCall, error) {
+	ce, sce := t.ce, t.sce
+
+	// the user may stop the generation without cancelling the command line
+	ctx, done := ce.Interruptible()
+	defer done()
+
+	stream := a.client.Chat.Completions.NewStreaming(
+		ctx,
+		params,
+		option.WithAPIKey(base.GetConfig(base.ConfigOpenAIAPIKey)),
+		option.WithBaseURL(base.GetConfig(base.ConfigOpenAIBaseURL)),
+	)
+
+	// optionally, an accumulator helper can be used
+	acc := openai.ChatCompletionAccumulator{}
+
+	isLeadingSpace := true
+	hasText := false
+
+	// when the output is not a terminal, hold the text back until we know whether it is
+	// the final answer or just narration before a tool call
+	live := t.live()
+	answer := strings.Builder{}
+	reasoning := a.newReasoningDisplay(t)
+
+	// on a terminal, the user sees the answer rendered, while the AI copy is kept as plain Markdown
+	var renderer *markdown.Renderer
+	if live && sce.ColorSupported() && base.GetConfig(base.ConfigRender) == base.RenderMarkdown {
+		renderer = markdown.NewRenderer(sce.UserStdout(), base.TerminalWidth(sce.UserStdout()))
+	}
+
+	for stream.Next() {
+		chunk := stream.Current()
+		acc.AddChunk(chunk)
 
-			if len(choice.Message.ToolCalls) > 0 {
-				hasToolCall = true
+		if len(chunk.Choices) == 0 {
+			continue
+		}
 
-				// Flush the leading answer text if it exists, and ensure the buffer is clean before handling the tool call
-				if answerText := a.truncateMessageText(ce.AnswerText()); answerText != "" {
-					qa.Answers = append(qa.Answers, base.AIAssistantAnswer{
-						Text:     answerText,
-						ToolCall: nil,
-					})
-					ce.Buffer().Reset()
+		if text := reasoningDelta(chunk.Choices[0].Delta); text != "" {
+			reasoning.Write(text)
+			ce.Emit(base.ExecutionEvent{Type: base.ExecutionEventReasoning, Data: text})
+		}
+
+		text := chunk.Choices[0].Delta.Content
+		if isLeadingSpace {
+			text = strings.TrimLeftFunc(text, unicode.IsSpace)
+			if text == "" {
+				continue
+			}
+		}
+		isLeadingSpace = false
+		if text != "" {
+			reasoning.End()
+			if renderer != nil {
+				sce.Stdai().Write([]byte(text))
+				renderer.Write([]byte(text))
+			} else if live {
+				if !hasText && sce.ColorSupported() {
+					fmt.Fprint(sce.Stdout(), base.ColorGray)
 				}
+				sce.Stdout().Write([]byte(text))
+			}
+			hasText = true
+			answer.WriteString(text)
+			ce.Emit(base.ExecutionEvent{Type: base.ExecutionEventToken, Data: text})
+		}
+	}
+	reasoning.End()
+	if renderer != nil {
+		renderer.Close()
+	} else if live && hasText && sce.ColorSupported() {
+		fmt.Fprint(sce.Stdout(), base.ColorReset)
+	}
 
-				toolCall := &choice.Message.ToolCalls[0]
-				err = a.handleToolCall(ce, sce, toolCall, shell)
-
-				if err != nil {
-					if answerText := a.truncateMessageText(ce.AnswerText()); answerText != "" {
-						qa.Answers = append(qa.Answers, base.AIAssistantAnswer{
-							Text:     answerText,
-							ToolCall: toolCall,
-						})
-					} else {
-						qa.Answers = append(qa.Answers, base.AIAssistantAnswer{
-							Text:     fmt.Sprintf("Error: %s", err.Error()),
-							ToolCall: toolCall,
-						})
-					}
+	if err := stream.Err(); err != nil {
+		if ctx.Err() != nil {
+			a.interruptAnswer(t, answer.String(), renderer != nil)
+			return "", nil, base.ErrInterrupted
+		}
+		if openaiErr, ok := err.(*openai.Error); ok {
+			if openaiErr.StatusCode == http.StatusUnauthorized {
+				if apiKey := base.GetConfig(base.ConfigOpenAIAPIKey); apiKey == "" {
+					fmt.Fprintln(sce.Stderr(), "Error: You haven't set the OpenAI API key, configure it by: aiset openai.api_key \"<your-api-key>\"")
+				} else {
+					fmt.Fprintln(sce.Stderr(), "Error: invalid OpenAI API key, review your configuration by: aiget")
 				}
-				ce.Buffer().Reset()
+				return "", nil, interp.ExitStatus(1)
 			}
 		}
+		return "", nil, err
+	}
 
-		if !hasToolCall {
-			break
+	var toolCall *openai.ChatCompletionMessageToolCall
+	if len(acc.Choices) > 0 && len(acc.Choices[0].Message.ToolCalls) > 0 {
+		toolCall = &acc.Choices[0].Message.ToolCalls[0]
+	}
+
+	text := strings.TrimRightFunc(answer.String(), unicode.IsSpace)
+	if hasText {
+		if renderer != nil {
+			sce.Stdai().Write([]byte("\n"))
+		} else if live {
+			sce.Stdout().Write([]byte("\n"))
+		} else if toolCall != nil {
+			// the AI copy is written explicitly, so that the answer is recorded
+			// no matter where the user output is redirected to
+			sce.Stdai().Write([]byte(text + "\n"))
+			a.narration(t).Write([]byte(text + "\n"))
+		} else if !t.holdAnswer {
+			sce.Stdai().Write([]byte(text + "\n"))
+			sce.UserStdout().Write([]byte(text + "\n"))
 		}
-		iter++
 	}
-	return true, nil
+	return text, toolCall, nil
 }
 
 func (a *AIPlugin) AfterExecute(ce *base.CommandExecution, sce *base.SubCommandExecution, shell *base.Shell) error {
 	if strings.EqualFold(sce.Cmd(), "reset") {
 		a.historyExecutions = nil
+		a.exhausted = nil
 		return nil
 	}
 
@@ -242,31 +372,65 @@ func (a *AIPlugin) AfterExecute(ce *base.CommandExecution, sce *base.SubCommandE
 		case string(ExtensionCommandAITool):
 			fallthrough
 		case string(ExtensionCommandHistory):
+			fallthrough
+		case string(ExtensionCommandAIAttach):
+			fallthrough
+		case string(ExtensionCommandAIMemory):
+			fallthrough
+		case string(ExtensionCommandAIMCP):
+			fallthrough
+		case string(ExtensionCommandAIUndo):
+			fallthrough
+		case string(ExtensionCommandAIAudit):
+			fallthrough
+		case string(ExtensionCommandAIRedact):
 		default:
 			defer ce.AppendQA(qa)
 		}
 	}
 
 	if err := sce.Error(); err != nil {
+		var limitErr *base.LimitError
 		if exitStatus, ok := err.(interp.ExitStatus); ok {
 			fmt.Fprintln(sce.Stdai(), a.formatExitStatus(exitStatus))
-		} else {
+		} else if errors.As(err, &limitErr) {
+			// reported by the tool call the command is a part of, which is stopped as a whole
+		} else if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(sce.Stdai(), a.formatExitStatus(130))
+		} else if !errors.Is(err, base.ErrInterrupted) {
+			// an interrupted answer is already marked
 			shell.PrintError(sce.Stderr(), err)
 		}
 	}
 
 	toolCall := qa.UnderToolCall
-	trace := qa.Trace()
+	// the answer is seen by the AI executions it is a part of, up to the delegated sub task if any
+	scope := qa.Scope()
 
-	if answerText := a.truncateMessageText(ce.AnswerText()); answerText != "" {
-		for _, qa := range trace {
+	withheld := a.takeWithheld(sce)
+	var attachments []*base.AIAttachment
+	if toolCall != nil && !withheld && isDefinedToolCommand(toolCall, sce.Fields()) {
+		attachments = a.collectImageAttachments(sce, shell, ce.AnswerText())
+	}
+
+	var answerText string
+	if withheld {
+		answerText = withheldOutput
+	} else if toolCall != nil {
+		answerText = a.toolOutputText(a.redactForAI(sce, shell, ce.AnswerText()))
+	} else {
+		answerText = a.truncateMessageText(a.redactForAI(sce, shell, ce.AnswerText()))
+	}
+	if answerText != "" {
+		for _, qa := range scope {
 			qa.Answers = append(qa.Answers, base.AIAssistantAnswer{
-				Text:     answerText,
-				ToolCall: toolCall,
+				Text:        answerText,
+				ToolCall:    toolCall,
+				Attachments: attachments,
 			})
 		}
 	} else {
-		for _, qa := range trace {
+		for _, qa := range scope {
 			qa.Answers = append(qa.Answers, a.generateFallbackAssistantAnswer(sce.Error(), toolCall))
 		}
 	}
@@ -274,8 +438,27 @@ func (a *AIPlugin) AfterExecute(ce *base.CommandExecution, sce *base.SubCommandE
 	return nil
 }
 
+// Close implements base.ShellPluginCloser, it stops the MCP servers and removes the spooled outputs.
+func (a *AIPlugin) Close(shell *base.Shell) error {
+	base.ClearMCPServers()
+
+	if a.outputs == nil {
+		return nil
+	}
+	err := a.outputs.Close()
+	a.outputs = nil
+	return err
+}
+
 // End implements base.ShellPlugin.
 func (a *AIPlugin) End(ce *base.CommandExecution, shell *base.Shell) error {
+	if a.checkpoint != nil {
+		if err := a.checkpoint.Seal(); err != nil {
+			shell.PrintError(os.Stderr, fmt.Errorf("checkpoint: %w", err))
+		}
+		a.checkpoint = nil
+	}
+
 	if len(ce.QA()) == 0 {
 		return nil
 	}
@@ -294,6 +477,11 @@ func (a *AIPlugin) End(ce *base.CommandExecution, shell *base.Shell) error {
 	return nil
 }
 
+// History returns the recent command lines and questions, with their answers, which are sent to the AI as the context.
+func (a *AIPlugin) History() []*base.AIExecution {
+	return a.historyExecutions
+}
+
 // AutoComplete implements base.ShellPlugin.
 func (a *AIPlugin) AutoComplete(line []rune, pos int, shell *base.Shell) (newLine [][]rune, length int) {
 	return nil, 0
@@ -304,33 +492,71 @@ func (a *AIPlugin) GeneratePrompt(ce *base.CommandExecution, shell *base.Shell)
 	return false, "", nil
 }
 
-func (a *AIPlugin) evalToolCall(
-	code []byte,
-	ce *base.CommandExecution,
-	sce *base.SubCommandExecution,
-	toolCall *openai.ChatCompletionMessageToolCall,
-	shell *base.Shell,
-) error {
+func (a *AIPlugin) evalToolCall(t *aiTurn, code []byte, toolCall *openai.ChatCompletionMessageToolCall) error {
 	if len(code) == 0 {
 		return nil
 	}
 
+	ce, sce, shell := t.ce, t.sce, t.shell
+
 	isBuiltin := true
-	qa := sce.QA()
+	qa := t.qa
 	// if the modifier function is never triggered, it means the command is a builtin command
-	err := shell.Eval(ce, code, func(child *base.SubCommandExecution) {
+	modifierFunc := func(child *base.SubCommandExecution) {
 		isBuiltin = false
-		child.Inherit(sce)
+		child.InheritWithQA(sce, qa)
 		child.SetMode(base.ShellModeUser)
 		child.QA().UnderToolCall = toolCall
-	})
+	}
 
+	t.toolCode = string(code)
+	if err := a.saveFiles(t, mutatedPaths(code, shell.Dir())...); err != nil {
+		shell.PrintError(sce.UserStderr(), fmt.Errorf("checkpoint: %w", err))
+	}
+
+	withheld := ce.Withheld()
+	defer ce.SetWithheld(withheld)
+	if ignoresCode(base.LoadAIIgnore(shell.Dir()), code, shell.Dir(), false) {
+		ce.SetWithheld(true)
+	}
+
+	// the limits apply to the code as a whole
+	timeout, maxOutput := a.toolLimits()
+	if t.toolTimeout > 0 {
+		timeout = t.toolTimeout
+	}
+
+	var err error
+	if t.live() {
+		err = shell.EvalWithLimits(ce, code, nil, nil, timeout, maxOutput, modifierFunc)
+	} else {
+		// keep the output of tool calls out of the final answer
+		output := io.MultiWriter(a.narration(t), sce.Stdai())
+		err = shell.EvalWithLimits(ce, code, output, output, timeout, maxOutput, modifierFunc)
+	}
+
+	var limitErr *base.LimitError
+	if errors.As(err, &limitErr) {
+		a.reportLimitError(t, toolCall, limitErr)
+		return err
+	}
 	if err != nil {
+		if ce.Withheld() && !hasToolAnswer(qa, toolCall) {
+			qa.Answers = append(qa.Answers, base.AIAssistantAnswer{
+				Text:     withheldOutput,
+				ToolCall: toolCall,
+			})
+		}
 		return err
 	}
 
 	if isBuiltin {
-		if answerText := a.truncateMessageText(ce.AnswerText()); answerText != "" {
+		if ce.Withheld() {
+			qa.Answers = append(qa.Answers, base.AIAssistantAnswer{
+				Text:     withheldOutput,
+				ToolCall: toolCall,
+			})
+		} else if answerText := a.toolOutputText(a.redactForAI(sce, shell, ce.AnswerText())); answerText != "" {
 			qa.Answers = append(qa.Answers, base.AIAssistantAnswer{
 				Text:     answerText,
 				ToolCall: toolCall,
@@ -342,8 +568,11 @@ func (a *AIPlugin) evalToolCall(
 	return err
 }
 
-func (a *AIPlugin) handleToolCall(ce *base.CommandExecution, sce *base.SubCommandExecution, toolCall *openai.ChatCompletionMessageToolCall, shell *base.Shell) error {
+func (a *AIPlugin) handleToolCall(t *aiTurn, toolCall *openai.ChatCompletionMessageToolCall) error {
 	toolName := toolCall.Function.Name
+	if !t.hasTool(toolName) {
+		return fmt.Errorf("%s: tool not available", toolName)
+	}
 
 	switch {
 	case toolName == string(ToolNameExecute):
@@ -355,13 +584,9 @@ func (a *AIPlugin) handleToolCall(ce *base.CommandExecution, sce *base.SubComman
 		if params.Code == "" {
 			return nil
 		}
-		if sce.ColorSupported() {
-			fmt.Fprintf(sce.Stdout(), "%suse:%s \033[4;34m%s\033[0m\n\n", base.ColorBlue, base.ColorReset, params.Code)
-		} else {
-			fmt.Fprintf(sce.Stdout(), "use: %s\n\n", params.Code)
-		}
+		a.narrateToolUse(t, "use", params.Code)
 
-		return a.evalToolCall([]byte(params.Code), ce, sce, toolCall, shell)
+		return a.evalToolCall(t, []byte(params.Code), toolCall)
 
 	case strings.HasPrefix(toolName, string(ToolNameUserDefinedPrefix)):
 		toolName := strings.TrimPrefix(toolName, string(ToolNameUserDefinedPrefix))
@@ -369,6 +594,9 @@ func (a *AIPlugin) handleToolCall(ce *base.CommandExecution, sce *base.SubComman
 		if !ok {
 			return fmt.Errorf("%s: tool not found", toolName)
 		}
+		if tool.Manifest != nil {
+			return a.handleManifestToolCall(t, tool, toolCall)
+		}
 		params := AIUserToolParams{}
 		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &params); err != nil {
 			return err
@@ -379,19 +607,53 @@ func (a *AIPlugin) handleToolCall(ce *base.CommandExecution, sce *base.SubComman
 			return err
 		}
 
-		if sce.ColorSupported() {
-			fmt.Fprintf(sce.Stdout(), "%suse tool:%s \033[4;34m%s\033[0m\n\n", base.ColorBlue, base.ColorReset, stmt)
-		} else {
-			fmt.Fprintf(sce.Stdout(), "use tool: %s\n\n", stmt)
-		}
+		a.narrateToolUse(t, "use tool", stmt)
+
+		return a.evalToolCall(t, []byte(stmt), toolCall)
+
+	case toolName == string(ToolNameRemember), toolName == string(ToolNameRecall), toolName == string(ToolNameForget):
+		return a.handleMemoryToolCall(t, toolCall)
+
+	case strings.HasPrefix(toolName, string(ToolNameMCPPrefix)):
+		return a.handleMCPToolCall(t, toolCall)
 
-		return a.evalToolCall([]byte(stmt), ce, sce, toolCall, shell)
+	case toolName == string(ToolNameDelegate):
+		return a.handleDelegateToolCall(t, toolCall)
+
+	case toolName == string(ToolNameReadOutput):
+		return a.handleReadOutputToolCall(t, toolCall)
+
+	case toolName == string(ToolNameReadFile), toolName == string(ToolNameWriteFile), toolName == string(ToolNameApplyPatch):
+		return a.handleFileToolCall(t, toolCall)
 
 	default:
 		return fmt.Errorf("%s: tool not found", toolCall.Function.Name)
 	}
 }
 
+// narrateToolUse tells the user which tool the AI is using, e.g. "use: ls -l".
+func (a *AIPlugin) narrateToolUse(t *aiTurn, label string, text string) {
+	t.ce.Emit(base.ExecutionEvent{Type: base.ExecutionEventToolCall, Data: fmt.Sprintf("%s: %s", label, text)})
+	if t.sce.ColorSupported() {
+		fmt.Fprintf(a.narration(t), "%s%s:%s \033[4;34m%s\033[0m\n\n", base.ColorBlue, label, base.ColorReset, text)
+	} else {
+		fmt.Fprintf(a.narration(t), "%s: %s\n\n", label, text)
+	}
+}
+
+// narration returns the writer for the content that describes the progress of an AI turn,
+// when the output is not a terminal, it is kept away from stdout so that only the final answer is printed there.
+func (a *AIPlugin) narration(t *aiTurn) io.Writer {
+	sce := t.sce
+	if t.live() {
+		return sce.Stdout()
+	}
+	if base.GetConfig(base.ConfigNarration) == base.NarrationNone {
+		return io.Discard
+	}
+	return sce.UserStderr()
+}
+
 func (a *AIPlugin) formatExitStatus(err interp.ExitStatus) string {
 	switch err {
 	case 130:
@@ -402,18 +664,56 @@ func (a *AIPlugin) formatExitStatus(err interp.ExitStatus) string {
 	return fmt.Sprintf("Exit status: %d\n", err)
 }
 
-func (a *AIPlugin) retrieveMessages(ce *base.CommandExecution, shell *base.Shell, extra *base.AIExecution) ([]openai.ChatCompletionMessageParamUnion, error) {
+// reportLimitError tells the AI and the user that the code of a tool call was stopped, with the output
+// of its builtins which is not recorded by the commands yet.
+func (a *AIPlugin) reportLimitError(t *aiTurn, toolCall *openai.ChatCompletionMessageToolCall, err *base.LimitError) {
+	ce, sce, shell := t.ce, t.sce, t.shell
+	if sce.Interactive() {
+		shell.PrintError(sce.UserStderr(), fmt.Errorf("command stopped: %w", err))
+	}
+
+	text := a.formatLimitError(err)
+	if ce.Withheld() {
+		text = withheldOutput + "\n" + text
+	} else if output := a.toolOutputText(a.redactForAI(sce, shell, ce.AnswerText())); output != "" {
+		text = output + "\n" + text
+	}
+	t.qa.Answers = append(t.qa.Answers, base.AIAssistantAnswer{
+		Text:     text,
+		ToolCall: toolCall,
+	})
+	ce.Buffer().Reset()
+}
+
+// formatLimitError tells the AI why its command was stopped, so that it can run another one.
+func (a *AIPlugin) formatLimitError(err *base.LimitError) string {
+	if err.Timeout > 0 {
+		return fmt.Sprintf("Exit status 124: command stopped, it %s. "+
+			"Narrow the command down, or run it in the background and check its output later.", err)
+	}
+	return fmt.Sprintf("Exit status 124: command stopped, its %s. "+
+		"Filter the output of the command, e.g. with grep, head or tail.", err)
+}
+
+func (a *AIPlugin) retrieveMessages(t *aiTurn) ([]openai.ChatCompletionMessageParamUnion, error) {
 	iterLimit := a.iterationLimit()
 	messages := make([]openai.ChatCompletionMessageParamUnion, 0, len(a.historyExecutions)*(1+iterLimit)+1)
 
-	if systemPrompt, err := a.generateSystemPrompt(shell); err != nil {
+	if systemPrompt, err := a.generateSystemPrompt(t); err != nil {
 		return nil, err
 	} else if systemPrompt != "" {
 		messages = append(messages, openai.SystemMessage(systemPrompt))
 	}
+	for _, instruction := range t.instructions {
+		messages = append(messages, openai.SystemMessage(instruction))
+	}
 
 	appendQA := func(qa *base.AIExecution) {
-		messages = append(messages, openai.UserMessage(qa.Question))
+		if len(qa.Attachments) > 0 {
+			messages = append(messages, openai.UserMessage(a.contentParts(qa.Question, qa.Attachments)))
+		} else {
+			messages = append(messages, openai.UserMessage(qa.Question))
+		}
 
 		for _, answer := range qa.Answers {
 			if answer.ToolCall != nil {
@@ -436,31 +736,89 @@ func (a *AIPlugin) retrieveMessages(ce *base.CommandExecution, shell *base.Shell
 							},
 						},
 					},
-					openai.ToolMessage(answer.Text, answer.ToolCall.ID),
+					openai.ToolMessage(envelopToolOutput(answer.ToolCall, answer.Text), answer.ToolCall.ID),
 				)
+
+				// tool messages are text only, images returned by the tool follow as a user message
+				if len(answer.Attachments) > 0 {
+					messages = append(messages, openai.UserMessage(a.contentParts(
+						fmt.Sprintf("Images returned by tool call %s:", answer.ToolCall.ID),
+						answer.Attachments,
+					)))
+				}
 			} else if answer.Text != "" {
 				messages = append(messages, openai.AssistantMessage(answer.Text))
 			}
 		}
 	}
 
-	// append the history executions
-	for _, qa := range a.historyExecutions {
-		appendQA(qa)
-	}
+	// a delegated sub task starts with a fresh context
+	if t.qa == nil || !t.qa.IsDelegated() {
+		// append the history executions
+		for _, qa := range a.historyExecutions {
+			appendQA(qa)
+		}
 
-	// append the current AI execution
-	for _, qa := range ce.QA() {
-		appendQA(qa)
+		// append the current AI execution
+		for _, qa := range t.ce.QA() {
+			appendQA(qa)
+		}
 	}
 
-	if extra != nil {
-		appendQA(extra)
+	if t.qa != nil {
+		appendQA(t.qa)
 	}
 
+	messages = append(messages, t.extra...)
 	return messages, nil
 }
 
+// isDefinedToolCommand reports whether a command runs the tool registered with aitool which the AI called.
+// Only such a tool can hand images back, any other output may be untrusted, e.g. a README printed by cat.
+func isDefinedToolCommand(toolCall *openai.ChatCompletionMessageToolCall, fields []string) bool {
+	name, ok := strings.CutPrefix(toolCall.Function.Name, string(ToolNameUserDefinedPrefix))
+	if !ok || len(fields) == 0 {
+		return false
+	}
+	tool, ok := base.GetDefinedTool(name)
+	return ok && fields[0] == tool.Entrypoint
+}
+
+// collectImageAttachments loads the images handed back by a tool with the image marker lines in its output,
+// the images must be in the working directory, as the files read by the AI.
+func (a *AIPlugin) collectImageAttachments(sce *base.SubCommandExecution, shell *base.Shell, output string) []*base.AIAttachment {
+	var attachments []*base.AIAttachment
+	for _, line := range strings.Split(output, "\n") {
+		file, ok := strings.CutPrefix(strings.TrimSpace(line), base.ImageMarker)
+		if !ok || file == "" {
+			continue
+		}
+		file, err := workspacePath(shell.Dir(), file)
+		if err != nil {
+			shell.PrintError(sce.UserStderr(), err)
+			continue
+		}
+		attachment, err := base.LoadImageAttachment(file)
+		if err != nil {
+			shell.PrintError(sce.UserStderr(), err)
+			continue
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments
+}
+
+func (a *AIPlugin) contentParts(text string, attachments []*base.AIAttachment) []openai.ChatCompletionContentPartUnionParam {
+	parts := make([]openai.ChatCompletionContentPartUnionParam, 0, len(attachments)+1)
+	parts = append(parts, openai.TextContentPart(text))
+	for _, attachment := range attachments {
+		parts = append(parts, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+			URL: attachment.DataURL(),
+		}))
+	}
+	return parts
+}
+
 func (a *AIPlugin) retrieveToolDefinitions() []openai.ChatCompletionToolParam {
 	tools := []openai.ChatCompletionToolParam{
 		{
@@ -481,9 +839,17 @@ func (a *AIPlugin) retrieveToolDefinitions() []openai.ChatCompletionToolParam {
 			},
 		},
 	}
+	tools = append(tools, a.delegateToolDefinition())
+	tools = append(tools, a.readOutputToolDefinition())
+	tools = append(tools, a.fileToolDefinitions()...)
+	tools = append(tools, a.memoryToolDefinitions()...)
 
 	definedTools := base.GetDefinedTools()
 	for _, tool := range definedTools {
+		if tool.Manifest != nil {
+			tools = append(tools, manifestToolDefinition(tool))
+			continue
+		}
 		usage := "none"
 		if tool.Usage != "" {
 			usage = tool.Usage
@@ -510,6 +876,7 @@ func (a *AIPlugin) retrieveToolDefinitions() []openai.ChatCompletionToolParam {
 			},
 		})
 	}
+	tools = append(tools, a.mcpToolDefinitions()...)
 
 	return tools
 }
@@ -528,7 +895,8 @@ func (a *AIPlugin) generateFallbackAssistantAnswer(err error, toolCall *openai.C
 	}
 }
 
-func (a *AIPlugin) generateSystemPrompt(shell *base.Shell) (string, error) {
+func (a *AIPlugin) generateSystemPrompt(t *aiTurn) (string, error) {
+	shell := t.shell
 	state := shell.State()
 	sb := strings.Builder{}
 
@@ -538,13 +906,14 @@ func (a *AIPlugin) generateSystemPrompt(shell *base.Shell) (string, error) {
 	}
 
 	if err := systemPromptTemplate.Execute(&sb, map[string]any{
-		"prompt": base.GetDefinedSystemPrompts(),
-		"cmd":    cmd,
-		"shell":  base.DefaultFileName,
-		"os":     state.OS(),
-		"arch":   state.Arch(),
-		"wd":     shell.Dir(),
-		"user":   state.User().Username,
+		"prompt":   base.GetDefinedSystemPrompts(),
+		"cmd":      cmd,
+		"shell":    base.DefaultFileName,
+		"os":       state.OS(),
+		"arch":     state.Arch(),
+		"wd":       shell.Dir(),
+		"user":     state.User().Username,
+		"memories": a.relevantMemories(t),
 	}); err != nil {
 		return "", err
 	}
@@ -565,6 +934,13 @@ func (a *AIPlugin) iterationLimit() int {
 	return 1
 }
 
+// toolLimits returns the limits of the commands run by the AI: the timeout and the max output in bytes.
+func (a *AIPlugin) toolLimits() (time.Duration, int64) {
+	timeout, _ := base.GetIntConfig(base.ConfigToolTimeout)
+	maxOutput, _ := base.GetIntConfig(base.ConfigToolMaxOutput)
+	return time.Duration(max(timeout, 0)) * time.Second, int64(max(maxOutput, 0))
+}
+
 func (a *AIPlugin) maxMessageLength() int {
 	if limit, ok := base.GetIntConfig(base.ConfigMaxMessageLength); ok {
 		return max(limit, 0)
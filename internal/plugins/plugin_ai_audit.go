@@ -0,0 +1,62 @@
+package plugins
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/ruandada/aish/internal/base"
+)
+
+// the approvals of the tool calls recorded in the audit log, for the changes to files and the calls after suspicious outputs
+const (
+	approvalAuto       = "auto"
+	approvalApproved   = "approved"
+	approvalRejected   = "rejected"
+	approvalDenied     = "denied"
+	approvalUnattended = "unattended"
+)
+
+// auditToolCall writes a tool call to the audit log, with the code it evaluated and the output given to the AI.
+func (a *AIPlugin) auditToolCall(t *aiTurn, toolCall *openai.ChatCompletionMessageToolCall, started time.Time, err error) {
+	output := strings.Builder{}
+	for _, answer := range t.qa.Answers {
+		if answer.ToolCall != nil && answer.ToolCall.ID == toolCall.ID {
+			output.WriteString(answer.Text)
+		}
+	}
+	hash := sha256.Sum256([]byte(output.String()))
+
+	args := json.RawMessage(toolCall.Function.Arguments)
+	if !json.Valid(args) {
+		args, _ = json.Marshal(toolCall.Function.Arguments)
+	}
+	trace := t.qa.Trace()
+
+	record := &base.AuditRecord{
+		Time:         started,
+		Session:      t.shell.State().Session(),
+		User:         t.shell.State().User().Username,
+		Dir:          t.shell.Dir(),
+		Question:     trace[len(trace)-1].Question,
+		Tool:         toolCall.Function.Name,
+		Arguments:    args,
+		Code:         t.toolCode,
+		ExitStatus:   base.ExitStatusOf(err),
+		DurationMS:   time.Since(started).Milliseconds(),
+		Approval:     t.toolApproval,
+		Risk:         t.toolRisk.String(),
+		OutputSize:   output.Len(),
+		OutputSHA256: hex.EncodeToString(hash[:]),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if err := base.AppendAuditRecord(record); err != nil {
+		t.shell.PrintError(t.sce.UserStderr(), fmt.Errorf("audit log: %w", err))
+	}
+}
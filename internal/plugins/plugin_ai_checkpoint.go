@@ -0,0 +1,206 @@
+package plugins
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ruandada/aish/internal/base"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// the commands which change the files given as arguments, the destination only for the copying ones
+var (
+	removingCommands = wordSet("rm unlink shred truncate")
+	creatingCommands = wordSet("tee touch")
+	copyingCommands  = wordSet("cp mv install")
+	// the commands which change their files in place with -i
+	inPlaceCommands = wordSet("sed perl")
+)
+
+// saveFiles saves the files before the AI changes them, in the checkpoint of the command line,
+// so that "aiundo" can restore them.
+func (a *AIPlugin) saveFiles(t *aiTurn, paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	if a.checkpoint == nil {
+		store, err := base.GetCheckpointStore()
+		if err != nil {
+			return err
+		}
+		trace := t.qa.Trace()
+		checkpoint, err := store.New(trace[len(trace)-1].Question, t.shell.Dir())
+		if err != nil {
+			return err
+		}
+		a.checkpoint = checkpoint
+	}
+
+	for _, path := range paths {
+		if err := a.checkpoint.Save(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mutatedPaths returns the files a command line run by the AI is likely to change: the targets of its output
+// redirections, and the arguments of the common commands changing files. It is best-effort, the paths
+// computed at run time are missed.
+func mutatedPaths(code []byte, dir string) []string {
+	file, err := syntax.NewParser().Parse(bytes.NewReader(code), "")
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.Redirect:
+			switch n.Op {
+			case syntax.RdrOut, syntax.AppOut, syntax.RdrInOut, syntax.ClbOut, syntax.RdrAll, syntax.AppAll:
+				paths = append(paths, literalPaths([]*syntax.Word{n.Word}, dir, true)...)
+			}
+		case *syntax.CallExpr:
+			paths = append(paths, commandPaths(n.Args, dir)...)
+		}
+		return true
+	})
+	return paths
+}
+
+// commandPaths returns the files changed by a command, if it is a common one changing files.
+func commandPaths(args []*syntax.Word, dir string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	name, ok := literalWord(args[0])
+	if !ok {
+		return nil
+	}
+	name = filepath.Base(name)
+
+	var operands []*syntax.Word
+	inPlace := false
+	flags := true
+	for _, arg := range args[1:] {
+		value, _ := literalWord(arg)
+		switch {
+		case flags && value == "--":
+			flags = false
+		case flags && strings.HasPrefix(value, "-"):
+			inPlace = inPlace || strings.HasPrefix(value, "-i") || value == "--in-place"
+		case strings.HasPrefix(value, "of=") && name == "dd":
+			return filterPaths([]string{absPath(dir, value[len("of="):])}, true)
+		default:
+			operands = append(operands, arg)
+		}
+	}
+
+	switch {
+	case removingCommands[name]:
+		return literalPaths(operands, dir, false)
+	case creatingCommands[name]:
+		return literalPaths(operands, dir, true)
+	case inPlaceCommands[name] && inPlace:
+		// the script is not a file, unless one happens to have its name
+		return literalPaths(operands, dir, false)
+	case copyingCommands[name] && len(operands) >= 2:
+		sources, dest := literalPaths(operands[:len(operands)-1], dir, false), literalPaths(operands[len(operands)-1:], dir, true)
+		if len(dest) != 1 {
+			return nil
+		}
+		var paths []string
+		if stat, err := os.Stat(dest[0]); err == nil && stat.IsDir() {
+			for _, source := range sources {
+				paths = append(paths, filepath.Join(dest[0], filepath.Base(source)))
+			}
+		} else {
+			paths = append(paths, dest[0])
+		}
+		if name == "mv" {
+			paths = append(paths, sources...)
+		}
+		return paths
+	}
+	return nil
+}
+
+// literalPaths returns the absolute paths of the literal words, with their globs expanded.
+// The missing files are kept if the command creates them.
+func literalPaths(words []*syntax.Word, dir string, missing bool) []string {
+	var paths []string
+	for _, word := range words {
+		value, ok := literalWord(word)
+		if !ok || value == "" {
+			continue
+		}
+		path := absPath(dir, value)
+		if strings.ContainsAny(value, "*?[") {
+			matches, _ := filepath.Glob(path)
+			paths = append(paths, matches...)
+		} else {
+			paths = append(paths, path)
+		}
+	}
+	return filterPaths(paths, missing)
+}
+
+// filterPaths keeps the files and the directories, and the missing paths if the command creates them,
+// but not the devices such as /dev/null.
+func filterPaths(paths []string, missing bool) []string {
+	kept := paths[:0]
+	for _, path := range paths {
+		stat, err := os.Lstat(path)
+		switch {
+		case err != nil:
+			if missing && os.IsNotExist(err) {
+				kept = append(kept, path)
+			}
+		case stat.Mode().IsRegular() || stat.IsDir():
+			kept = append(kept, path)
+		}
+	}
+	return kept
+}
+
+func absPath(dir string, path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return filepath.Clean(path)
+}
+
+// literalWord returns the value of a word made of literals and quotes only, without expansions.
+func literalWord(word *syntax.Word) (string, bool) {
+	sb := strings.Builder{}
+	for _, part := range word.Parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			sb.WriteString(p.Value)
+		case *syntax.SglQuoted:
+			if p.Dollar {
+				return "", false
+			}
+			sb.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			for _, part := range p.Parts {
+				lit, ok := part.(*syntax.Lit)
+				if !ok {
+					return "", false
+				}
+				sb.WriteString(lit.Value)
+			}
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), true
+}
@@ -0,0 +1,263 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/shared"
+	"github.com/ruandada/aish/internal/base"
+)
+
+// the longest time the model is asked to classify an input, it is executed as a command afterwards
+const classifierTimeout = 10 * time.Second
+
+// classification is the decision whether the input of the auto mode is a command or natural language.
+type classification struct {
+	natural bool
+	// the confidence of the decision, between 0.5 and 1
+	confidence float64
+	// how the decision was made, e.g. "heuristic" or "model"
+	source string
+}
+
+// the words that are common in sentences but rarely the arguments of commands
+var stopwords = wordSet("a an the this that these those here there me my mine you your it its i we our us " +
+	"he she they them his her their what which who whom whose when where why how please can could would " +
+	"should will shall do does did is are was were be been am have has had to of in on at for with from " +
+	"about into over under by and or but not any some every each than then so if just also")
+
+// the weights of the features of an input, a positive score means natural language
+const (
+	weightBias      = -1.5
+	weightFlag      = -2.5
+	weightPath      = -1.5
+	weightQuoted    = -1.0
+	weightStopword  = 1.2
+	weightWord      = 0.3
+	weightNonASCII  = 1.5
+	weightQuestion  = 2.0
+	weightPeriod    = 1.0
+	weightSentence  = 1.0
+	sentenceMinArgs = 3
+)
+
+// classify decides whether the input of the auto mode is a command or natural language before executing it.
+func (a *AIPlugin) classify(ce *base.CommandExecution, sce *base.SubCommandExecution, shell *base.Shell) (classification, error) {
+	mode := base.GetConfig(base.ConfigClassifier)
+	if mode == base.ClassifierOff {
+		return classification{}, nil
+	}
+
+	threshold := 0.7
+	if percent, ok := base.GetIntConfig(base.ConfigClassifierConfidence); ok {
+		threshold = math.Min(math.Max(float64(percent), 50), 100) / 100
+	}
+
+	p := naturalLanguageProbability(sce.Fields(), shell.Dir())
+	switch {
+	case p >= threshold:
+		return classification{natural: true, confidence: p, source: base.ClassifierHeuristic}, nil
+	case 1-p >= threshold:
+		return classification{confidence: 1 - p, source: base.ClassifierHeuristic}, nil
+	}
+
+	// a command which is not found is asked to the AI anyway
+	if _, err := shell.LookPath(sce.Cmd()); mode != base.ClassifierModel || err != nil {
+		return classification{confidence: 1 - p, source: base.ClassifierHeuristic}, nil
+	}
+
+	c, err := a.classifyWithModel(ce.Context(), sce, shell)
+	if err != nil {
+		if ce.Context().Err() != nil {
+			return classification{}, ce.Context().Err()
+		}
+		// the uncertain input is executed as a command, as if there were no classifier
+		return classification{confidence: 1 - p, source: base.ClassifierHeuristic}, nil
+	}
+	if c.natural && c.confidence < threshold {
+		c = classification{confidence: 1 - c.confidence, source: base.ClassifierModel}
+	}
+	return c, nil
+}
+
+// naturalLanguageProbability estimates the probability that the words of a command line are a sentence,
+// from the shape of its arguments: flags and paths are typical of commands, stopwords and punctuation of sentences.
+func naturalLanguageProbability(fields []string, dir string) float64 {
+	args := fields[1:]
+	if len(args) == 0 {
+		return 0
+	}
+
+	score := weightBias
+	sentence := len(args) >= sentenceMinArgs
+	hasStopword := false
+	for i, arg := range args {
+		word := arg
+		if i == len(args)-1 {
+			switch {
+			case strings.HasSuffix(arg, "?"):
+				score += weightQuestion
+			case strings.HasSuffix(arg, ".") || strings.HasSuffix(arg, "!"):
+				score += weightPeriod
+			}
+			word = strings.TrimRight(arg, "?.!")
+		}
+		word = strings.TrimRight(word, ",")
+
+		switch {
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			score += weightFlag
+			sentence = false
+		case strings.ContainsAny(arg, " \t\n"):
+			score += weightQuoted
+			sentence = false
+		case isExistingPath(word, dir) || strings.ContainsAny(word, "/.=:*~$@%+#_{}[]<>|\\"):
+			score += weightPath
+			sentence = false
+		case stopwords[strings.ToLower(word)]:
+			score += weightStopword
+			hasStopword = true
+		case isPlainWord(word):
+			if strings.IndexFunc(word, func(c rune) bool { return c > unicode.MaxASCII }) >= 0 {
+				score += weightNonASCII
+			} else {
+				score += weightWord
+			}
+		case strings.Trim(word, "0123456789") == "":
+			// numbers are as common in sentences as in commands
+		default:
+			sentence = false
+		}
+	}
+	if sentence && hasStopword {
+		score += weightSentence
+	}
+	return 1 / (1 + math.Exp(-score))
+}
+
+func wordSet(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+// isPlainWord reports whether s is made of letters, e.g. "files", "don't" or "well-known".
+func isPlainWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !unicode.IsLetter(c) && c != '\'' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func isExistingPath(name string, dir string) bool {
+	if name == "" {
+		return false
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+type classifierAnswer struct {
+	Kind       string  `json:"kind"`
+	Confidence float64 `json:"confidence"`
+}
+
+var classifierSchema = base.JSONSchema{
+	"type": "object",
+	"properties": map[string]any{
+		"kind": map[string]any{
+			"type": "string",
+			"enum": []any{"command", "natural_language"},
+		},
+		"confidence": map[string]any{
+			"type": "number",
+		},
+	},
+	"required":             []any{"kind", "confidence"},
+	"additionalProperties": false,
+}
+
+const classifierPrompt = "You classify the input of a shell which accepts both commands and requests in natural language. " +
+	"The first word of the input is the name of an installed program. " +
+	"Decide whether the input is a command to execute, or a request to the AI written in natural language. " +
+	`Answer with a JSON document: {"kind": "command" | "natural_language", "confidence": <number between 0 and 1>}.`
+
+// classifyWithModel asks the model whether an uncertain input is a command or natural language.
+func (a *AIPlugin) classifyWithModel(ctx context.Context, sce *base.SubCommandExecution, shell *base.Shell) (classification, error) {
+	ctx, cancel := context.WithTimeout(ctx, classifierTimeout)
+	defer cancel()
+
+	model := base.GetConfig(base.ConfigClassifierModel)
+	if model == "" {
+		model = base.GetConfig(base.ConfigOpenAIModel)
+	}
+
+	completion, err := a.client.Chat.Completions.New(
+		ctx,
+		openai.ChatCompletionNewParams{
+			Model: model,
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.SystemMessage(classifierPrompt),
+				openai.UserMessage(fmt.Sprintf("Working directory: %s\nInput: %s", shell.Dir(), strings.Join(sce.Fields(), " "))),
+			},
+			ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+				OfJSONSchema: &shared.ResponseFormatJSONSchemaParam{
+					JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{
+						Name:   "classification",
+						Schema: map[string]any(classifierSchema),
+						Strict: openai.Bool(true),
+					},
+				},
+			},
+		},
+		option.WithAPIKey(base.GetConfig(base.ConfigOpenAIAPIKey)),
+		option.WithBaseURL(base.GetConfig(base.ConfigOpenAIBaseURL)),
+	)
+	if err != nil {
+		return classification{}, err
+	}
+	if len(completion.Choices) == 0 {
+		return classification{}, fmt.Errorf("no classification")
+	}
+
+	answer := classifierAnswer{}
+	if err := json.Unmarshal([]byte(completion.Choices[0].Message.Content), &answer); err != nil {
+		return classification{}, err
+	}
+	confidence := math.Min(math.Max(answer.Confidence, 0), 1)
+	if answer.Kind != "natural_language" {
+		return classification{confidence: confidence, source: base.ClassifierModel}, nil
+	}
+	return classification{natural: true, confidence: confidence, source: base.ClassifierModel}, nil
+}
+
+// indicateClassification tells the user that the input was taken as natural language and is asked to the AI.
+func (a *AIPlugin) indicateClassification(sce *base.SubCommandExecution, c classification) {
+	if !sce.Interactive() && base.GetConfig(base.ConfigNarration) == base.NarrationNone {
+		return
+	}
+	text := fmt.Sprintf("natural language detected (%s, %.0f%%), asking AI", c.source, c.confidence*100)
+	if sce.ColorSupported() {
+		text = base.ColorGray + base.Italic + text + base.ColorReset
+	}
+	fmt.Fprintln(sce.UserStderr(), text)
+}
@@ -0,0 +1,89 @@
+package plugins
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/openai/openai-go"
+	"github.com/ruandada/aish/internal/base"
+	"mvdan.cc/sh/v3/interp"
+)
+
+const exhaustedInstruction = "You have reached the limit of tool calls for this question. " +
+	"Without calling any tool, summarize the progress so far, what is left to do, and the next steps."
+
+// summarizeExhaustedTurn is called when a turn reached its iteration limit, it asks the model for a summary
+// of the progress without tools, which is the answer of the turn, and tells the user how to continue.
+func (a *AIPlugin) summarizeExhaustedTurn(t *aiTurn) (string, error) {
+	// a turn without tools is already a summary, e.g. a retry of a JSON answer
+	if len(t.tools) == 0 {
+		return "", nil
+	}
+
+	summary := *t
+	summary.tools = nil
+	summary.iterLimit = 0
+	summary.extra = append(slices.Clone(t.extra), openai.UserMessage(exhaustedInstruction))
+
+	answer, err := a.runTurn(&summary)
+	if err != nil {
+		return "", err
+	}
+
+	// delegated sub tasks and nested questions give their summary back to the caller, and the held answers
+	// of aitest and --json are not the summary, those are asked again rather than continued
+	if t.qa.IsRoot() && !t.qa.IsDelegated() && !t.holdAnswer {
+		a.exhausted = t.qa
+		fmt.Fprintf(
+			t.sce.UserStderr(),
+			"aish: iteration limit (%d) reached, run \"aicontinue [n]\" to grant n more iterations\n",
+			t.iterLimit,
+		)
+	}
+	return answer, nil
+}
+
+// startQuestion forgets the turn which reached its iteration limit when a new question is asked,
+// "aicontinue" only resumes the last one.
+func (a *AIPlugin) startQuestion(t *aiTurn) {
+	if t.qa.IsRoot() && !t.qa.IsDelegated() {
+		a.exhausted = nil
+	}
+}
+
+// executeContinue resumes the turn which reached its iteration limit, with the same question and answers.
+func (a *AIPlugin) executeContinue(ce *base.CommandExecution, sce *base.SubCommandExecution, shell *base.Shell) error {
+	iterLimit := a.iterationLimit()
+	if fields := sce.Fields(); len(fields) > 1 {
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n <= 0 || len(fields) > 2 {
+			fmt.Fprintln(sce.Stderr(), "Usage:\n  aicontinue [n]")
+			return interp.ExitStatus(2)
+		}
+		iterLimit = n
+	}
+
+	qa := a.exhausted
+	if qa == nil {
+		fmt.Fprintln(sce.Stderr(), "aicontinue: no AI task to continue")
+		return interp.ExitStatus(1)
+	}
+	a.exhausted = nil
+
+	// the question is answered again as the current command, so it leaves the history
+	// and the command line it was asked in, and its summary is dropped to let the model go on from its last tool call
+	a.historyExecutions = slices.DeleteFunc(a.historyExecutions, func(e *base.AIExecution) bool {
+		return e == qa
+	})
+	ce.RemoveQA(qa)
+	if n := len(qa.Answers); n > 0 && qa.Answers[n-1].ToolCall == nil {
+		qa.Answers = qa.Answers[:n-1]
+	}
+	sce.SetQA(qa)
+
+	t := a.newTurn(ce, sce, shell, qa)
+	t.iterLimit = iterLimit
+	_, err := a.runTurn(t)
+	return err
+}
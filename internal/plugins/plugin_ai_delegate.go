@@ -0,0 +1,113 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/ruandada/aish/internal/base"
+)
+
+const delegateInstruction = "You are working on a sub task delegated by another assistant, who only sees your final answer. " +
+	"Complete the task with the tools, then answer with a concise summary of what you found and did, " +
+	"including the details the other assistant needs to continue, such as paths, names and numbers."
+
+// the summary given back when the sub task ends without a final answer
+const delegateUnfinished = "The sub task was not finished within its iteration limit."
+
+func (a *AIPlugin) delegateToolDefinition() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Type: "function",
+		Function: openai.FunctionDefinitionParam{
+			Name: string(ToolNameDelegate),
+			Description: openai.String("Delegate a self-contained sub task, e.g. a long investigation, to another assistant " +
+				"working in a fresh context with the same tools, only its final summary is returned"),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"task": map[string]any{
+						"type":        "string",
+						"description": "The task, with all the context needed to complete it",
+					},
+					"tools": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Names of the tools allowed for the task, all of them by default",
+					},
+					"max_iter": map[string]any{
+						"type":        "integer",
+						"description": "The maximum number of tool calls",
+					},
+				},
+				"required": []string{"task"},
+			},
+		},
+	}
+}
+
+// handleDelegateToolCall answers the sub task with a child AI turn, and records its summary as the result of the tool call.
+func (a *AIPlugin) handleDelegateToolCall(t *aiTurn, toolCall *openai.ChatCompletionMessageToolCall) error {
+	params := AIDelegateToolParams{}
+	if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &params); err != nil {
+		return err
+	}
+	params.Task = strings.TrimSpace(params.Task)
+	if params.Task == "" {
+		return fmt.Errorf("empty task")
+	}
+	a.narrateToolUse(t, "delegate", params.Task)
+
+	child := *t
+	child.qa = t.qa.Delegate(params.Task)
+	child.qa.UnderToolCall = toolCall
+	child.instructions = append(slices.Clone(t.instructions), delegateInstruction)
+	child.extra = nil
+	child.responseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{}
+	child.holdAnswer = true
+	// the work of the sub task is narrated, but only its summary is the answer
+	child.quiet = true
+
+	if params.MaxIter > 0 {
+		child.iterLimit = min(params.MaxIter, a.iterationLimit())
+	} else {
+		child.iterLimit = a.iterationLimit()
+	}
+
+	// no recursive delegation
+	child.tools = nil
+	for _, tool := range t.tools {
+		name := tool.Function.Name
+		if name == string(ToolNameDelegate) {
+			continue
+		}
+		if len(params.Tools) > 0 && !slices.Contains(params.Tools, name) {
+			continue
+		}
+		child.tools = append(child.tools, tool)
+	}
+
+	summary, err := a.runTurn(&child)
+	// an output read by the sub task may have misled the AI in the parent task too
+	t.suspiciousTool = child.suspiciousTool
+	if t.suspiciousTool != "" {
+		t.qa.SuspiciousTool = t.suspiciousTool
+	}
+	if err != nil {
+		return err
+	}
+	if summary == "" {
+		summary = delegateUnfinished
+	} else {
+		child.qa.Answers = append(child.qa.Answers, base.AIAssistantAnswer{Text: summary})
+	}
+	fmt.Fprintf(a.narration(t), "%s\n\n", summary)
+
+	t.qa.Answers = append(t.qa.Answers, base.AIAssistantAnswer{
+		Text:      a.truncateMessageText(summary),
+		ToolCall:  toolCall,
+		Delegated: child.qa,
+	})
+	return nil
+}
@@ -7,3 +7,51 @@ type AIExecToolParams struct {
 type AIUserToolParams struct {
 	Args []string `json:"args"`
 }
+
+type AIRememberToolParams struct {
+	Content string   `json:"content"`
+	Scope   string   `json:"scope"`
+	Tags    []string `json:"tags"`
+}
+
+type AIRecallToolParams struct {
+	Query string `json:"query"`
+	Limit int    `json:"limit"`
+}
+
+type AIForgetToolParams struct {
+	ID string `json:"id"`
+}
+
+type AIMCPReadResourceToolParams struct {
+	Server string `json:"server"`
+	URI    string `json:"uri"`
+}
+
+type AIDelegateToolParams struct {
+	Task    string   `json:"task"`
+	Tools   []string `json:"tools"`
+	MaxIter int      `json:"max_iter"`
+}
+
+type AIReadOutputToolParams struct {
+	ID      string `json:"id"`
+	Offset  int    `json:"offset"`
+	Length  int    `json:"length"`
+	Pattern string `json:"pattern"`
+}
+
+type AIReadFileToolParams struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+}
+
+type AIWriteFileToolParams struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+type AIApplyPatchToolParams struct {
+	Patch string `json:"patch"`
+}
@@ -0,0 +1,463 @@
+package plugins
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/ruandada/aish/internal/base"
+	"github.com/ruandada/aish/internal/patch"
+)
+
+const (
+	// the lines of context around the changes shown before they are applied
+	previewContext = 3
+	// the most lines of a preview, the rest of the changes is summarized
+	maxPreviewLines = 200
+	// the key pressed on the terminal by Ctrl-C, which is not a signal in raw mode
+	keyInterrupt = 3
+)
+
+// fileChange is a change of a file by the AI, which is previewed and approved before it is written.
+type fileChange struct {
+	// the absolute path of the file, and its name as given by the AI
+	path string
+	name string
+
+	before string
+	after  string
+	// whether the file is created or deleted by the change
+	creation bool
+	deletion bool
+}
+
+func (a *AIPlugin) fileToolDefinitions() []openai.ChatCompletionToolParam {
+	return []openai.ChatCompletionToolParam{
+		{
+			Type: "function",
+			Function: openai.FunctionDefinitionParam{
+				Name: string(ToolNameReadFile),
+				Description: openai.String("Read a text file in the working directory, the lines are returned with their line number. " +
+					"Prefer it to cat, its output is exact"),
+				Parameters: openai.FunctionParameters{
+					"type": "object",
+					"properties": map[string]any{
+						"path": map[string]any{
+							"type":        "string",
+							"description": "The path of the file, relative to the working directory",
+						},
+						"start_line": map[string]any{
+							"type":        "integer",
+							"description": "The first line to read, from 1",
+						},
+						"end_line": map[string]any{
+							"type":        "integer",
+							"description": "The last line to read, the end of the file by default",
+						},
+					},
+					"required": []string{"path"},
+				},
+			},
+		},
+		{
+			Type: "function",
+			Function: openai.FunctionDefinitionParam{
+				Name: string(ToolNameWriteFile),
+				Description: openai.String("Write the whole content of a file in the working directory, which is created if needed. " +
+					"The user sees the changes and approves them before they are written"),
+				Parameters: openai.FunctionParameters{
+					"type": "object",
+					"properties": map[string]any{
+						"path": map[string]any{
+							"type":        "string",
+							"description": "The path of the file, relative to the working directory",
+						},
+						"content": map[string]any{
+							"type":        "string",
+							"description": "The new content of the file",
+						},
+					},
+					"required": []string{"path", "content"},
+				},
+			},
+		},
+		{
+			Type: "function",
+			Function: openai.FunctionDefinitionParam{
+				Name: string(ToolNameApplyPatch),
+				Description: openai.String("Change files in the working directory with a unified diff, prefer it to WRITE_FILE for small changes of large files. " +
+					"Each file starts with \"--- <path>\" and \"+++ <path>\" lines, /dev/null to create or delete it, followed by its hunks. " +
+					"The context lines of the hunks must match the file exactly, read it first. " +
+					"The user sees the changes and approves them before they are written"),
+				Parameters: openai.FunctionParameters{
+					"type": "object",
+					"properties": map[string]any{
+						"patch": map[string]any{
+							"type":        "string",
+							"description": "The unified diff",
+						},
+					},
+					"required": []string{"patch"},
+				},
+			},
+		},
+	}
+}
+
+// handleFileToolCall reads or changes files for the AI. Its errors are recorded as they are, e.g. the hunk of
+// a patch which didn't apply, so that the AI can fix its call.
+func (a *AIPlugin) handleFileToolCall(t *aiTurn, toolCall *openai.ChatCompletionMessageToolCall) error {
+	var result string
+	var err error
+	switch ToolName(toolCall.Function.Name) {
+	case ToolNameReadFile:
+		params := AIReadFileToolParams{}
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &params); err != nil {
+			return err
+		}
+		result, err = a.readFile(t, params)
+
+	case ToolNameWriteFile:
+		params := AIWriteFileToolParams{}
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &params); err != nil {
+			return err
+		}
+		result, err = a.writeFile(t, params)
+
+	case ToolNameApplyPatch:
+		params := AIApplyPatchToolParams{}
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &params); err != nil {
+			return err
+		}
+		result, err = a.applyPatch(t, params)
+	}
+
+	if err != nil {
+		result = fmt.Sprintf("Error: %s", err.Error())
+	}
+	t.qa.Answers = append(t.qa.Answers, base.AIAssistantAnswer{
+		Text:     result,
+		ToolCall: toolCall,
+	})
+	return err
+}
+
+func (a *AIPlugin) readFile(t *aiTurn, params AIReadFileToolParams) (string, error) {
+	if params.StartLine > 0 || params.EndLine > 0 {
+		a.narrateToolUse(t, "read file", fmt.Sprintf("%s:%d-%d", params.Path, max(params.StartLine, 1), params.EndLine))
+	} else {
+		a.narrateToolUse(t, "read file", params.Path)
+	}
+
+	path, err := workspacePath(t.shell.Dir(), params.Path)
+	if err != nil {
+		return "", err
+	}
+	text, ok, err := readFileText(path)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("%s: no such file", params.Path)
+	}
+
+	lines := patch.SplitLines(text)
+	start, end := max(params.StartLine, 1), params.EndLine
+	if end <= 0 || end > len(lines) {
+		end = len(lines)
+	}
+	if len(lines) == 0 {
+		return fmt.Sprintf("%s is empty", params.Path), nil
+	}
+	if start > end {
+		return "", fmt.Errorf("%s: no line in %d-%d, the file has %d lines", params.Path, start, end, len(lines))
+	}
+
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "%s, lines %d-%d of %d:\n", params.Path, start, end, len(lines))
+	for i := start; i <= end; i++ {
+		fmt.Fprintf(&sb, "%d\t%s\n", i, lines[i-1])
+	}
+	return a.toolOutputText(a.redactForAI(t.sce, t.shell, sb.String())), nil
+}
+
+func (a *AIPlugin) writeFile(t *aiTurn, params AIWriteFileToolParams) (string, error) {
+	a.narrateToolUse(t, "write file", params.Path)
+
+	path, err := workspacePath(t.shell.Dir(), params.Path)
+	if err != nil {
+		return "", err
+	}
+	before, ok, err := readFileText(path)
+	if err != nil {
+		return "", err
+	}
+	if ok && before == params.Content {
+		return fmt.Sprintf("%s is unchanged", params.Path), nil
+	}
+
+	change := &fileChange{path: path, name: params.Path, before: before, after: params.Content, creation: !ok}
+	if err := a.applyFileChanges(t, []*fileChange{change}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("wrote %d bytes to %s", len(params.Content), params.Path), nil
+}
+
+func (a *AIPlugin) applyPatch(t *aiTurn, params AIApplyPatchToolParams) (string, error) {
+	patches, err := patch.Parse(params.Patch)
+	if err != nil {
+		a.narrateToolUse(t, "apply patch", "invalid patch")
+		return "", fmt.Errorf("invalid patch: %w", err)
+	}
+
+	names := make([]string, 0, len(patches))
+	for _, p := range patches {
+		names = append(names, p.Path())
+	}
+	a.narrateToolUse(t, "apply patch", strings.Join(names, ", "))
+
+	changes := make([]*fileChange, 0, len(patches))
+	for _, p := range patches {
+		path, err := workspacePath(t.shell.Dir(), p.Path())
+		if err != nil {
+			return "", err
+		}
+		before, ok, err := readFileText(path)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case p.IsCreation() && ok:
+			return "", fmt.Errorf("%s: the file already exists, it can't be created", p.Path())
+		case !p.IsCreation() && !ok:
+			return "", fmt.Errorf("%s: no such file", p.Path())
+		}
+
+		after, err := p.Apply(before)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", p.Path(), err)
+		}
+		changes = append(changes, &fileChange{
+			path:     path,
+			name:     p.Path(),
+			before:   before,
+			after:    after,
+			creation: p.IsCreation(),
+			deletion: p.IsDeletion(),
+		})
+	}
+
+	if err := a.applyFileChanges(t, changes); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("patched %s", strings.Join(names, ", ")), nil
+}
+
+// applyFileChanges shows the changes to the user, and writes them once they are approved.
+func (a *AIPlugin) applyFileChanges(t *aiTurn, changes []*fileChange) error {
+	w := a.narration(t)
+	if t.live() {
+		// the preview is for the user, the AI knows the changes already
+		w = t.sce.UserStdout()
+	}
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s\n\n", formatFileChange(c, t.sce.ColorSupported()))
+	}
+
+	if err := a.approveFileChanges(t, changes); err != nil {
+		return err
+	}
+	for _, c := range changes {
+		if err := a.saveFiles(t, c.path); err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+		if err := c.write(); err != nil {
+			return fmt.Errorf("%s: %w", c.name, err)
+		}
+	}
+	return nil
+}
+
+// approveFileChanges asks the user whether the changes can be written, according to file_approval.
+func (a *AIPlugin) approveFileChanges(t *aiTurn, changes []*fileChange) error {
+	switch base.GetConfig(base.ConfigFileApproval) {
+	case base.FileApprovalAuto:
+		t.toolApproval = approvalAuto
+		return nil
+	case base.FileApprovalDeny:
+		t.toolApproval = approvalDenied
+		return errors.New("the user doesn't allow changing files, file_approval is deny")
+	}
+
+	names := make([]string, 0, len(changes))
+	for _, c := range changes {
+		names = append(names, c.name)
+	}
+	approved, err := a.askApproval(t, fmt.Sprintf("Apply the changes to %s? [y/N] ", strings.Join(names, ", ")), "changing files")
+	if err != nil {
+		return err
+	}
+	if !approved {
+		return errors.New("the user rejected the changes")
+	}
+	return nil
+}
+
+// askApproval asks the user to approve an action of the AI with "y", and records the approval for the audit log.
+func (a *AIPlugin) askApproval(t *aiTurn, question string, action string) (bool, error) {
+	sce := t.sce
+	if !sce.Interactive() {
+		t.toolApproval = approvalUnattended
+		return false, fmt.Errorf("%s needs the approval of the user, who can't be asked without a terminal", action)
+	}
+
+	if sce.ColorSupported() {
+		question = base.ColorYellow + question + base.ColorReset
+	}
+	fmt.Fprint(sce.UserStdout(), question)
+
+	key, err := base.ReadKey(sce.Stdin())
+	if err != nil {
+		fmt.Fprintln(sce.UserStdout())
+		t.toolApproval = approvalUnattended
+		return false, fmt.Errorf("the approval of the user can't be asked: %w", err)
+	}
+	switch key {
+	case 'y', 'Y':
+		fmt.Fprintln(sce.UserStdout(), "yes")
+		t.toolApproval = approvalApproved
+		return true, nil
+	case keyInterrupt:
+		fmt.Fprintln(sce.UserStdout())
+		t.toolApproval = approvalRejected
+		return false, base.ErrInterrupted
+	default:
+		fmt.Fprintln(sce.UserStdout(), "no")
+		t.toolApproval = approvalRejected
+		return false, nil
+	}
+}
+
+// write writes the change to the file, all the changes of the AI to files are written by it.
+func (c *fileChange) write() error {
+	if c.deletion {
+		return os.Remove(c.path)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, []byte(c.after), 0644)
+}
+
+// formatFileChange returns the unified diff of a change, colored for a terminal.
+func formatFileChange(c *fileChange, color bool) string {
+	oldName, newName := "a/"+c.name, "b/"+c.name
+	if c.creation {
+		oldName = patch.DevNull
+	}
+	if c.deletion {
+		newName = patch.DevNull
+	}
+
+	var diff string
+	if edits, ok := patch.Diff(patch.SplitLines(c.before), patch.SplitLines(c.after)); ok {
+		diff = patch.Unified(oldName, newName, patch.Hunks(edits, previewContext))
+	} else {
+		diff = fmt.Sprintf("--- %s\n+++ %s\n[the file is rewritten, %d lines are replaced by %d lines]\n",
+			oldName, newName, len(patch.SplitLines(c.before)), len(patch.SplitLines(c.after)))
+	}
+
+	lines := patch.SplitLines(diff)
+	if n := len(lines); n > maxPreviewLines {
+		lines = append(lines[:maxPreviewLines], fmt.Sprintf("[... %d more lines of changes ...]", n-maxPreviewLines))
+	}
+	if color {
+		for i, line := range lines {
+			switch {
+			case i < 2:
+				lines[i] = base.Bold + line + base.ColorReset
+			case strings.HasPrefix(line, "@@"):
+				lines[i] = base.ColorCyan + line + base.ColorReset
+			case strings.HasPrefix(line, "-"):
+				lines[i] = base.ColorRed + line + base.ColorReset
+			case strings.HasPrefix(line, "+"):
+				lines[i] = base.ColorGreen + line + base.ColorReset
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// readFileText returns the content of a text file, and false if it doesn't exist.
+func readFileText(path string) (string, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", false, fmt.Errorf("%s: binary file", path)
+	}
+	return string(data), true, nil
+}
+
+// workspacePath returns the absolute path of a file given by the AI, which must be in the working directory,
+// even once its symbolic links are followed.
+func workspacePath(dir string, name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", errors.New("empty path")
+	}
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := evalExistingSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: outside of the working directory %s", name, dir)
+	}
+	if base.AIIgnored(path) || base.AIIgnored(resolved) {
+		return "", fmt.Errorf("%s: ignored by %s", name, base.AIIgnoreFileName)
+	}
+	return path, nil
+}
+
+// evalExistingSymlinks follows the symbolic links of the part of the path which exists.
+func evalExistingSymlinks(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		// a broken link would be written through
+		if _, err := os.Lstat(path); err == nil {
+			return "", fmt.Errorf("%s: broken symbolic link", path)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
@@ -0,0 +1,113 @@
+package plugins
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/ruandada/aish/internal/base"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// withheldOutput replaces the outputs kept out of the AI context by .aiignore.
+const withheldOutput = "[output withheld by policy]"
+
+// the shortest value of an ignored environment variable which is withheld, the shorter ones are too common
+const minWithheldEnvLength = 4
+
+// withholdOutput keeps the output of a command out of the execution buffer, if .aiignore ignores it,
+// or the command line it is a part of. The command still runs, and the user sees its output.
+func (a *AIPlugin) withholdOutput(ce *base.CommandExecution, sce *base.SubCommandExecution, shell *base.Shell) {
+	if !ce.Withheld() {
+		ignore := base.LoadAIIgnore(shell.Dir())
+		if ignore.Empty() {
+			return
+		}
+		withheld := ignoresFields(ignore, sce.Fields(), shell.Dir())
+		// the files read by the redirections of the command line of the user, which are not among the fields,
+		// the tool calls are checked as a whole by evalToolCall
+		if !withheld && sce.QA().UnderToolCall == nil {
+			withheld = ignoresCode(ignore, ce.Input(), shell.Dir(), true)
+		}
+		if !withheld {
+			return
+		}
+		// the rest of the command line is withheld too, e.g. the commands reading the output from a pipe
+		ce.SetWithheld(true)
+	}
+	a.withheld.Store(sce, true)
+}
+
+// takeWithheld reports whether the output of a command is withheld, once it is done.
+func (a *AIPlugin) takeWithheld(sce *base.SubCommandExecution) bool {
+	_, ok := a.withheld.LoadAndDelete(sce)
+	return ok
+}
+
+// ignoresCode reports whether a command line runs a command ignored by .aiignore, or reads an ignored file,
+// only by a redirection if redirectionsOnly is true.
+func ignoresCode(ignore *base.AIIgnore, code []byte, dir string, redirectionsOnly bool) bool {
+	if ignore.Empty() || len(code) == 0 {
+		return false
+	}
+	file, err := syntax.NewParser().Parse(bytes.NewReader(code), "")
+	if err != nil {
+		return false
+	}
+
+	ignored := false
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.Redirect:
+			if value, ok := literalWord(n.Word); ok && value != "" && ignore.IgnoresPath(absPath(dir, value)) {
+				ignored = true
+			}
+		case *syntax.CallExpr:
+			if redirectionsOnly {
+				break
+			}
+			var fields []string
+			for _, arg := range n.Args {
+				value, ok := literalWord(arg)
+				if !ok {
+					break
+				}
+				fields = append(fields, value)
+			}
+			ignored = ignored || ignoresFields(ignore, fields, dir)
+		}
+		return !ignored
+	})
+	return ignored
+}
+
+// ignoresFields reports whether a command is ignored by .aiignore, or has an ignored file as an argument.
+func ignoresFields(ignore *base.AIIgnore, fields []string, dir string) bool {
+	if ignore.IgnoresCommand(fields) {
+		return true
+	}
+	for _, field := range fields {
+		// the values of options, e.g. --env-file=.env
+		if _, value, ok := strings.Cut(field, "="); ok && strings.HasPrefix(field, "-") {
+			field = value
+		}
+		if field != "" && !strings.HasPrefix(field, "-") && ignore.IgnoresPath(absPath(dir, field)) {
+			return true
+		}
+	}
+	return false
+}
+
+// withholdEnv replaces the values of the environment variables ignored by .aiignore in an output sent to the AI.
+func withholdEnv(shell *base.Shell, text string) string {
+	ignore := base.LoadAIIgnore(shell.Dir())
+	if ignore.Empty() {
+		return text
+	}
+	for _, variable := range shell.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		if len(value) >= minWithheldEnvLength && ignore.IgnoresEnv(name) {
+			text = strings.ReplaceAll(text, value, withheldOutput)
+		}
+	}
+	return text
+}
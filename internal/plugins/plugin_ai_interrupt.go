@@ -0,0 +1,59 @@
+package plugins
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/openai/openai-go"
+	"github.com/ruandada/aish/internal/base"
+)
+
+// interruptedMarker follows the partial answer of an interrupted generation, which is kept in the history,
+// so that the next questions can refer to it.
+const interruptedMarker = "[interrupted by user]"
+
+// interruptAnswer marks the partial answer of an interrupted generation, both for the user and in the AI copy.
+func (a *AIPlugin) interruptAnswer(t *aiTurn, partial string, rendered bool) {
+	sce := t.sce
+	partial = strings.TrimRightFunc(partial, unicode.IsSpace)
+
+	marker := interruptedMarker
+	if sce.ColorSupported() {
+		marker = base.ColorGray + interruptedMarker + base.ColorReset
+	}
+
+	switch {
+	case rendered:
+		// the renderer leaves the cursor at the beginning of a line
+		if partial != "" {
+			fmt.Fprint(sce.Stdai(), "\n\n")
+			fmt.Fprint(sce.UserStdout(), "\n")
+		}
+		fmt.Fprintln(sce.Stdai(), interruptedMarker)
+		fmt.Fprintln(sce.UserStdout(), marker)
+	case t.live():
+		// the partial answer is written to the captured stdout, which keeps the order in the AI copy
+		if partial != "" {
+			fmt.Fprint(sce.Stdout(), "\n\n")
+		}
+		fmt.Fprintln(sce.Stdout(), marker)
+	default:
+		// the partial answer was held back
+		if partial != "" {
+			partial += "\n\n"
+		}
+		fmt.Fprintln(sce.Stdai(), partial+interruptedMarker)
+		fmt.Fprintln(a.narration(t), partial+interruptedMarker)
+	}
+}
+
+// hasToolAnswer reports whether the result of the tool call is recorded.
+func hasToolAnswer(qa *base.AIExecution, toolCall *openai.ChatCompletionMessageToolCall) bool {
+	for _, answer := range qa.Answers {
+		if answer.ToolCall != nil && answer.ToolCall.ID == toolCall.ID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+	"github.com/ruandada/aish/internal/base"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// executeJSON runs an AI turn whose final answer must be a JSON document, the answer is validated locally
+// and the model is asked to correct it until it is valid or the retries are exhausted.
+func (a *AIPlugin) executeJSON(t *aiTurn, opts *aiQuestionOptions) error {
+	sce := t.sce
+
+	var schema base.JSONSchema
+	if opts.schema != "" {
+		file := opts.schema
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(t.shell.Dir(), file)
+		}
+		s, err := base.LoadJSONSchema(file)
+		if err != nil {
+			return err
+		}
+		// the answers would be accepted without the constraints which are not checked
+		if err := s.CheckKeywords(); err != nil {
+			return fmt.Errorf("%s: %w", opts.schema, err)
+		}
+		schema = s
+	}
+
+	t.quiet = true
+	t.holdAnswer = true
+	if schema != nil {
+		b, err := json.Marshal(schema)
+		if err != nil {
+			return err
+		}
+		t.instructions = append(t.instructions, fmt.Sprintf("Your final answer must be a single JSON document conforming to the following JSON schema, without any other text:\n%s", b))
+		t.responseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &shared.ResponseFormatJSONSchemaParam{
+				JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   "answer",
+					Schema: map[string]any(schema),
+					Strict: openai.Bool(false),
+				},
+			},
+		}
+	} else {
+		t.instructions = append(t.instructions, "Your final answer must be a single JSON document, without any other text.")
+		t.responseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONObject: &shared.ResponseFormatJSONObjectParam{},
+		}
+	}
+
+	answer, err := a.runTurn(t)
+	if err != nil {
+		return err
+	}
+
+	retries := a.jsonRetries()
+	for i := 0; ; i++ {
+		document, err := a.validateJSONAnswer(answer, schema)
+		if err == nil {
+			sce.Stdai().Write([]byte(document + "\n"))
+			sce.UserStdout().Write([]byte(document + "\n"))
+			return nil
+		}
+
+		if i >= retries {
+			fmt.Fprintf(sce.Stderr(), "Error: invalid JSON answer: %s\n", err.Error())
+			return interp.ExitStatus(1)
+		}
+		fmt.Fprintf(a.narration(t), "invalid JSON answer, retrying: %s\n", err.Error())
+
+		// the correction is a plain completion, the data needed is already in the context
+		retry := *t
+		retry.tools = nil
+		retry.iterLimit = 0
+		retry.extra = append(append([]openai.ChatCompletionMessageParamUnion{}, t.extra...),
+			openai.AssistantMessage(answer),
+			openai.UserMessage(fmt.Sprintf("Your answer is invalid: %s\nReply again with the corrected JSON document only.", err.Error())),
+		)
+		if answer, err = a.runTurn(&retry); err != nil {
+			return err
+		}
+	}
+}
+
+// validateJSONAnswer extracts the JSON document from the answer and validates it against the schema.
+func (a *AIPlugin) validateJSONAnswer(answer string, schema base.JSONSchema) (string, error) {
+	document := strings.TrimSpace(answer)
+
+	// tolerate the document being wrapped in a markdown code block
+	if strings.HasPrefix(document, "```") {
+		document = strings.TrimPrefix(document, "```json")
+		document = strings.TrimPrefix(document, "```")
+		document = strings.TrimSuffix(strings.TrimSpace(document), "```")
+		document = strings.TrimSpace(document)
+	}
+
+	if document == "" {
+		return "", fmt.Errorf("empty answer")
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		return "", err
+	}
+
+	if schema != nil {
+		if err := schema.Validate(value); err != nil {
+			return "", err
+		}
+	}
+	return document, nil
+}
+
+func (a *AIPlugin) jsonRetries() int {
+	if retries, ok := base.GetIntConfig(base.ConfigJSONRetries); ok {
+		return max(retries, 0)
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/ruandada/aish/internal/base"
+)
+
+func manifestToolDefinition(tool *base.DefinedTool) openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Type: "function",
+		Function: openai.FunctionDefinitionParam{
+			Name:        string(ToolNameUserDefinedPrefix) + tool.Name,
+			Description: openai.String(tool.Manifest.Description),
+			Parameters:  openai.FunctionParameters(tool.Manifest.Parameters),
+		},
+	}
+}
+
+// handleManifestToolCall runs the command of a tool declared by a manifest, once the arguments of the call
+// are validated against its parameters.
+func (a *AIPlugin) handleManifestToolCall(t *aiTurn, tool *base.DefinedTool, toolCall *openai.ChatCompletionMessageToolCall) error {
+	params := map[string]any{}
+	if args := strings.TrimSpace(toolCall.Function.Arguments); args != "" {
+		if err := json.Unmarshal([]byte(args), &params); err != nil {
+			return fmt.Errorf("%s: invalid arguments: %w", tool.Name, err)
+		}
+	}
+	invocation, err := tool.Manifest.Invocation(params)
+	if err != nil {
+		return fmt.Errorf("%s: invalid arguments: %w", tool.Name, err)
+	}
+
+	code, err := invocation.CommandLine()
+	if err != nil {
+		return err
+	}
+	t.toolTimeout = time.Duration(tool.Manifest.Timeout)
+
+	a.narrateToolUse(t, "use tool", code)
+	return a.evalToolCall(t, []byte(code), toolCall)
+}
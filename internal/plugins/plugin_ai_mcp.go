@@ -0,0 +1,195 @@
+package plugins
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/ruandada/aish/internal/base"
+	"github.com/ruandada/aish/internal/mcp"
+)
+
+// the longest tool name accepted by the API
+const maxToolNameLength = 64
+
+var invalidToolNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// mcpToolName returns the namespaced name of a tool of an MCP server, e.g. "MCP_github__create_issue".
+// A name too long is truncated with a hash of the whole name, so that the tools with the same prefix differ.
+func mcpToolName(server string, tool string) string {
+	name := string(ToolNameMCPPrefix) + server + "__" + invalidToolNameChars.ReplaceAllString(tool, "_")
+	if len(name) > maxToolNameLength {
+		hash := sha256.Sum256([]byte(server + "\x00" + tool))
+		suffix := "_" + hex.EncodeToString(hash[:4])
+		name = name[:maxToolNameLength-len(suffix)] + suffix
+	}
+	return name
+}
+
+func lookupMCPTool(toolName string) (*mcp.Client, *mcp.Tool, bool) {
+	for _, client := range base.GetMCPServers() {
+		tools := client.Tools()
+		for i := range tools {
+			if mcpToolName(client.Name(), tools[i].Name) == toolName {
+				return client, &tools[i], true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+func (a *AIPlugin) mcpToolDefinitions() []openai.ChatCompletionToolParam {
+	tools := []openai.ChatCompletionToolParam{}
+	servers := []string{}
+	resources := strings.Builder{}
+
+	for _, client := range base.GetMCPServers() {
+		for _, tool := range client.Tools() {
+			parameters := openai.FunctionParameters(tool.InputSchema)
+			if parameters == nil {
+				parameters = openai.FunctionParameters{"type": "object", "properties": map[string]any{}}
+			}
+
+			tools = append(tools, openai.ChatCompletionToolParam{
+				Type: "function",
+				Function: openai.FunctionDefinitionParam{
+					Name:        mcpToolName(client.Name(), tool.Name),
+					Description: openai.String(fmt.Sprintf("[%s] %s", client.Name(), tool.Description)),
+					Parameters:  parameters,
+				},
+			})
+		}
+
+		if len(client.Resources()) > 0 {
+			servers = append(servers, client.Name())
+			for _, resource := range client.Resources() {
+				fmt.Fprintf(&resources, "\n- server: %s, uri: %s, name: %s", client.Name(), resource.URI, resource.Name)
+				if resource.Description != "" {
+					fmt.Fprintf(&resources, ", description: %s", resource.Description)
+				}
+			}
+		}
+	}
+
+	if len(servers) > 0 {
+		tools = append(tools, openai.ChatCompletionToolParam{
+			Type: "function",
+			Function: openai.FunctionDefinitionParam{
+				Name:        string(ToolNameMCPReadResource),
+				Description: openai.String("Read a resource of an MCP server, the available resources are:" + resources.String()),
+				Parameters: openai.FunctionParameters{
+					"type": "object",
+					"properties": map[string]any{
+						"server": map[string]any{
+							"type": "string",
+							"enum": servers,
+						},
+						"uri": map[string]any{
+							"type": "string",
+						},
+					},
+					"required": []string{"server", "uri"},
+				},
+			},
+		})
+	}
+	return tools
+}
+
+func (a *AIPlugin) handleMCPToolCall(t *aiTurn, toolCall *openai.ChatCompletionMessageToolCall) error {
+	ctx := t.ce.Context()
+
+	var text string
+	var attachments []*base.AIAttachment
+
+	if toolCall.Function.Name == string(ToolNameMCPReadResource) {
+		params := AIMCPReadResourceToolParams{}
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &params); err != nil {
+			return err
+		}
+		client, ok := base.GetMCPServer(params.Server)
+		if !ok {
+			return fmt.Errorf("%s: server not found", params.Server)
+		}
+		a.narrateToolUse(t, "use mcp", fmt.Sprintf("%s %s", client.Name(), params.URI))
+
+		result, err := client.ReadResource(ctx, params.URI)
+		if err != nil {
+			return err
+		}
+		texts := []string{}
+		for _, contents := range result.Contents {
+			if contents.Text != "" {
+				texts = append(texts, contents.Text)
+			} else if attachment := a.mcpImageAttachment(t, contents.URI, contents.MimeType, contents.Blob); attachment != nil {
+				attachments = append(attachments, attachment)
+			}
+		}
+		text = strings.Join(texts, "\n")
+	} else {
+		client, tool, ok := lookupMCPTool(toolCall.Function.Name)
+		if !ok {
+			return fmt.Errorf("%s: tool not found", toolCall.Function.Name)
+		}
+
+		arguments := map[string]any{}
+		if args := strings.TrimSpace(toolCall.Function.Arguments); args != "" {
+			if err := json.Unmarshal([]byte(args), &arguments); err != nil {
+				return err
+			}
+		}
+		a.narrateToolUse(t, "use mcp", fmt.Sprintf("%s.%s %s", client.Name(), tool.Name, toolCall.Function.Arguments))
+
+		result, err := client.CallTool(ctx, tool.Name, arguments)
+		if err != nil {
+			return err
+		}
+		text = result.Text()
+		for _, content := range result.Content {
+			if content.Type == "image" {
+				if attachment := a.mcpImageAttachment(t, tool.Name, content.MimeType, content.Data); attachment != nil {
+					attachments = append(attachments, attachment)
+				}
+			}
+		}
+		if result.IsError {
+			text = "Error: " + text
+		}
+	}
+
+	if text != "" {
+		fmt.Fprintln(a.narration(t), text)
+	}
+
+	answer := base.AIAssistantAnswer{
+		Text:        a.toolOutputText(a.redactForAI(t.sce, t.shell, text)),
+		ToolCall:    toolCall,
+		Attachments: attachments,
+	}
+	if answer.Text == "" {
+		answer.Text = "done"
+	}
+	t.qa.Answers = append(t.qa.Answers, answer)
+	return nil
+}
+
+func (a *AIPlugin) mcpImageAttachment(t *aiTurn, name string, mimeType string, data string) *base.AIAttachment {
+	if !strings.HasPrefix(mimeType, "image/") || data == "" {
+		return nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err == nil {
+		var attachment *base.AIAttachment
+		if attachment, err = base.NewImageAttachment(name, raw); err == nil {
+			return attachment
+		}
+	}
+	t.shell.PrintError(t.sce.UserStderr(), err)
+	return nil
+}
@@ -0,0 +1,173 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/ruandada/aish/internal/base"
+)
+
+const defaultRecallLimit = 10
+
+func (a *AIPlugin) memoryToolDefinitions() []openai.ChatCompletionToolParam {
+	return []openai.ChatCompletionToolParam{
+		{
+			Type: "function",
+			Function: openai.FunctionDefinitionParam{
+				Name:        string(ToolNameRemember),
+				Description: openai.String("Remember a short fact across sessions, e.g. a host name, a preference of the user or a convention of the project"),
+				Parameters: openai.FunctionParameters{
+					"type": "object",
+					"properties": map[string]any{
+						"content": map[string]any{
+							"type":        "string",
+							"description": "The fact to remember, in one self-contained sentence",
+						},
+						"scope": map[string]any{
+							"type":        "string",
+							"enum":        []string{string(base.MemoryScopeGlobal), string(base.MemoryScopeWorkspace)},
+							"description": "global for facts about the user, workspace for facts only true in the current working directory",
+						},
+						"tags": map[string]any{
+							"type":  "array",
+							"items": map[string]any{"type": "string"},
+						},
+					},
+					"required": []string{"content"},
+				},
+			},
+		},
+		{
+			Type: "function",
+			Function: openai.FunctionDefinitionParam{
+				Name:        string(ToolNameRecall),
+				Description: openai.String("Search the remembered facts by keywords, all of them are listed when the query is empty"),
+				Parameters: openai.FunctionParameters{
+					"type": "object",
+					"properties": map[string]any{
+						"query": map[string]any{
+							"type": "string",
+						},
+						"limit": map[string]any{
+							"type": "integer",
+						},
+					},
+				},
+			},
+		},
+		{
+			Type: "function",
+			Function: openai.FunctionDefinitionParam{
+				Name:        string(ToolNameForget),
+				Description: openai.String("Forget a remembered fact which is wrong or outdated"),
+				Parameters: openai.FunctionParameters{
+					"type": "object",
+					"properties": map[string]any{
+						"id": map[string]any{
+							"type":        "string",
+							"description": "The id of the fact",
+						},
+					},
+					"required": []string{"id"},
+				},
+			},
+		},
+	}
+}
+
+func (a *AIPlugin) handleMemoryToolCall(t *aiTurn, toolCall *openai.ChatCompletionMessageToolCall) error {
+	store, err := base.GetMemoryStore()
+	if err != nil {
+		return err
+	}
+
+	var result string
+	switch ToolName(toolCall.Function.Name) {
+	case ToolNameRemember:
+		params := AIRememberToolParams{}
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &params); err != nil {
+			return err
+		}
+		scope := base.MemoryScope(params.Scope)
+		if scope == "" {
+			scope = base.MemoryScopeGlobal
+		}
+		a.narrateToolUse(t, "remember", params.Content)
+
+		memory, err := store.Add(params.Content, scope, t.shell.Dir(), params.Tags)
+		if err != nil {
+			return err
+		}
+		result = fmt.Sprintf("remembered as %s", memory.ID)
+
+	case ToolNameRecall:
+		params := AIRecallToolParams{}
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &params); err != nil {
+			return err
+		}
+		if params.Limit <= 0 {
+			params.Limit = defaultRecallLimit
+		}
+		a.narrateToolUse(t, "recall", params.Query)
+
+		var memories []*base.Memory
+		if strings.TrimSpace(params.Query) == "" {
+			memories = store.List(t.shell.Dir())
+			memories = memories[max(len(memories)-params.Limit, 0):]
+		} else {
+			memories = store.Search(params.Query, t.shell.Dir(), params.Limit)
+		}
+		result = formatMemories(memories)
+		if result == "" {
+			result = "nothing found"
+		}
+
+	case ToolNameForget:
+		params := AIForgetToolParams{}
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &params); err != nil {
+			return err
+		}
+		a.narrateToolUse(t, "forget", params.ID)
+
+		if ok, err := store.Remove(params.ID); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("%s: memory not found", params.ID)
+		}
+		result = "forgotten"
+	}
+
+	t.qa.Answers = append(t.qa.Answers, base.AIAssistantAnswer{
+		Text:     result,
+		ToolCall: toolCall,
+	})
+	return nil
+}
+
+// relevantMemories returns the memories related to the question, which are put into the system prompt.
+func (a *AIPlugin) relevantMemories(t *aiTurn) []*base.Memory {
+	limit, _ := base.GetIntConfig(base.ConfigMaxMemories)
+	if limit <= 0 || t.qa == nil {
+		return nil
+	}
+
+	store, err := base.GetMemoryStore()
+	if err != nil {
+		return nil
+	}
+	return store.Search(t.qa.Question, t.shell.Dir(), limit)
+}
+
+func formatMemories(memories []*base.Memory) string {
+	sb := strings.Builder{}
+	for _, memory := range memories {
+		fmt.Fprintf(&sb, "[%s] %s", memory.ID, memory.Content)
+		if len(memory.Tags) > 0 {
+			fmt.Fprintf(&sb, " (tags: %s)", strings.Join(memory.Tags, ", "))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
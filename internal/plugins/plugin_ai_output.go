@@ -0,0 +1,264 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/openai/openai-go"
+	"github.com/ruandada/aish/internal/base"
+)
+
+const (
+	// the most outputs kept by a shell, the oldest ones are removed
+	maxSpooledOutputs = 100
+	// the spools of the shells which are gone are removed after this time, which leaves a new spool
+	// the time to be locked by its shell
+	spoolRetention = time.Minute
+	spoolPattern   = "aish-outputs-*"
+	// the file locked by the shell of a spool while it runs
+	spoolLockName = "spool"
+
+	defaultReadOutputLength = 4096
+	maxReadOutputLength     = 16384
+	// the longest matching line returned by a search, the rest is cut
+	maxMatchLineLength = 300
+)
+
+// outputStore spools the full outputs of the tool calls in a temporary directory,
+// the AI only gets their head and tail and reads the rest with READ_OUTPUT.
+type outputStore struct {
+	dir  string
+	ids  []string
+	next int
+	// releases the lock of the spool, which tells the other shells it is in use
+	unlock func()
+}
+
+func newOutputStore() (*outputStore, error) {
+	removeStaleSpools()
+
+	dir, err := os.MkdirTemp("", spoolPattern)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := base.LockFile(filepath.Join(dir, spoolLockName))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return &outputStore{dir: dir, unlock: unlock}, nil
+}
+
+// removeStaleSpools removes the spools of the shells which are gone, e.g. killed, the others keep them locked.
+func removeStaleSpools() {
+	dirs, _ := filepath.Glob(filepath.Join(os.TempDir(), spoolPattern))
+	for _, dir := range dirs {
+		if stat, err := os.Stat(dir); err != nil || time.Since(stat.ModTime()) <= spoolRetention {
+			continue
+		}
+		if unlock, err := base.TryLockFile(filepath.Join(dir, spoolLockName)); err == nil {
+			unlock()
+			_ = os.RemoveAll(dir)
+		}
+	}
+}
+
+// Close removes the spool, once the shell exits.
+func (s *outputStore) Close() error {
+	s.unlock()
+	return os.RemoveAll(s.dir)
+}
+
+func (s *outputStore) path(id string) string {
+	return filepath.Join(s.dir, id+".txt")
+}
+
+// Add spools an output and returns its id.
+func (s *outputStore) Add(text string) (string, error) {
+	s.next++
+	id := fmt.Sprintf("out-%d", s.next)
+	if err := os.WriteFile(s.path(id), []byte(text), 0600); err != nil {
+		return "", err
+	}
+
+	s.ids = append(s.ids, id)
+	if len(s.ids) > maxSpooledOutputs {
+		_ = os.Remove(s.path(s.ids[0]))
+		s.ids = s.ids[1:]
+	}
+	return id, nil
+}
+
+func (s *outputStore) Read(id string) (string, error) {
+	if !slices.Contains(s.ids, id) {
+		return "", fmt.Errorf("%s: output not found", id)
+	}
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (a *AIPlugin) outputStore() (*outputStore, error) {
+	if a.outputs == nil {
+		store, err := newOutputStore()
+		if err != nil {
+			return nil, err
+		}
+		a.outputs = store
+	}
+	return a.outputs, nil
+}
+
+// toolOutputText returns the output of a tool call as it is given to the AI. An output longer than
+// max_message_length is spooled in full, and only its head and tail are given with the id to read the rest.
+func (a *AIPlugin) toolOutputText(text string) string {
+	limit := a.maxMessageLength()
+	if limit == 0 || len(text) <= limit {
+		return a.truncateMessageText(text)
+	}
+
+	store, err := a.outputStore()
+	if err != nil {
+		return a.truncateMessageText(text)
+	}
+	id, err := store.Add(text)
+	if err != nil {
+		return a.truncateMessageText(text)
+	}
+
+	head := text[:runeBoundary(text, limit/2)]
+	tail := text[runeBoundary(text, len(text)-limit/2):]
+	return fmt.Sprintf("%s\n[... %d bytes omitted, the full output of %d bytes is kept as %s, use %s to read or search it ...]\n%s",
+		head, len(text)-len(head)-len(tail), len(text), id, ToolNameReadOutput, tail)
+}
+
+// runeBoundary returns the start of the rune at the byte offset i of s.
+func runeBoundary(s string, i int) int {
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
+
+func (a *AIPlugin) readOutputToolDefinition() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Type: "function",
+		Function: openai.FunctionDefinitionParam{
+			Name: string(ToolNameReadOutput),
+			Description: openai.String("Read a page of a long tool output which was cut, or search its lines with a pattern. " +
+				"The offsets are in bytes, the matching lines are returned with their line number and offset."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"id": map[string]any{
+						"type":        "string",
+						"description": "The id of the output, e.g. out-1",
+					},
+					"offset": map[string]any{
+						"type":        "integer",
+						"description": "Where to start reading or searching",
+					},
+					"length": map[string]any{
+						"type":        "integer",
+						"description": fmt.Sprintf("The number of bytes to return, at most %d", maxReadOutputLength),
+					},
+					"pattern": map[string]any{
+						"type":        "string",
+						"description": "A regular expression, to return the matching lines only",
+					},
+				},
+				"required": []string{"id"},
+			},
+		},
+	}
+}
+
+func (a *AIPlugin) handleReadOutputToolCall(t *aiTurn, toolCall *openai.ChatCompletionMessageToolCall) error {
+	params := AIReadOutputToolParams{}
+	if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &params); err != nil {
+		return err
+	}
+	if params.Pattern != "" {
+		a.narrateToolUse(t, "search output", fmt.Sprintf("%s /%s/", params.ID, params.Pattern))
+	} else {
+		a.narrateToolUse(t, "read output", fmt.Sprintf("%s at %d", params.ID, params.Offset))
+	}
+
+	store, err := a.outputStore()
+	if err != nil {
+		return err
+	}
+	output, err := store.Read(params.ID)
+	if err != nil {
+		return err
+	}
+
+	length := params.Length
+	if length <= 0 {
+		length = defaultReadOutputLength
+	}
+	length = min(length, maxReadOutputLength)
+	offset := runeBoundary(output, min(max(params.Offset, 0), len(output)))
+
+	var result string
+	if params.Pattern == "" {
+		end := runeBoundary(output, min(offset+length, len(output)))
+		result = fmt.Sprintf("bytes %d-%d of %d:\n%s", offset, end, len(output), output[offset:end])
+	} else {
+		re, err := regexp.Compile(params.Pattern)
+		if err != nil {
+			return err
+		}
+		result = searchOutput(output, offset, length, re)
+	}
+
+	t.qa.Answers = append(t.qa.Answers, base.AIAssistantAnswer{
+		Text:     result,
+		ToolCall: toolCall,
+	})
+	return nil
+}
+
+// searchOutput returns the lines matching the pattern from the offset, up to about length bytes.
+func searchOutput(output string, offset int, length int, re *regexp.Regexp) string {
+	// the line numbers are counted from the beginning of the output
+	lineStart := strings.LastIndexByte(output[:offset], '\n') + 1
+	lineNumber := strings.Count(output[:lineStart], "\n") + 1
+
+	sb := strings.Builder{}
+	for pos := lineStart; pos < len(output); lineNumber++ {
+		end := strings.IndexByte(output[pos:], '\n')
+		if end < 0 {
+			end = len(output)
+		} else {
+			end += pos
+		}
+		line := output[pos:end]
+
+		if re.MatchString(line) {
+			if sb.Len() >= length {
+				fmt.Fprintf(&sb, "[more matches, search again from offset %d]\n", pos)
+				break
+			}
+			if len(line) > maxMatchLineLength {
+				line = line[:runeBoundary(line, maxMatchLineLength)] + "…"
+			}
+			fmt.Fprintf(&sb, "%d@%d: %s\n", lineNumber, pos, line)
+		}
+		pos = end + 1
+	}
+
+	if sb.Len() == 0 {
+		return "no match"
+	}
+	return "line@offset: text\n" + sb.String()
+}
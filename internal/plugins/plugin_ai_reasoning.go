@@ -0,0 +1,104 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/ruandada/aish/internal/base"
+)
+
+// the fields used by providers to stream the reasoning of reasoning models
+var reasoningDeltaFields = []string{"reasoning_content", "reasoning"}
+
+func reasoningDelta(delta openai.ChatCompletionChunkChoiceDelta) string {
+	for _, name := range reasoningDeltaFields {
+		field, ok := delta.JSON.ExtraFields[name]
+		if !ok {
+			continue
+		}
+		text := ""
+		if err := json.Unmarshal([]byte(field.Raw()), &text); err == nil && text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// reasoningDisplay shows the reasoning of a model to the user only, so that it never appears in the answers.
+type reasoningDisplay struct {
+	mode   string
+	writer io.Writer
+	color  bool
+
+	started bool
+	ended   bool
+	size    int
+}
+
+func (a *AIPlugin) newReasoningDisplay(t *aiTurn) *reasoningDisplay {
+	mode := base.GetConfig(base.ConfigReasoning)
+	writer := a.narration(t)
+	if t.live() {
+		writer = t.sce.UserStdout()
+	} else if mode == base.ReasoningCollapsed {
+		// a collapsed line can only be redrawn on a terminal
+		mode = base.ReasoningHidden
+	}
+
+	return &reasoningDisplay{
+		mode:   mode,
+		writer: writer,
+		color:  t.sce.ColorSupported(),
+	}
+}
+
+func (d *reasoningDisplay) Write(text string) {
+	if d.ended {
+		return
+	}
+	d.size += len(strings.Fields(text))
+
+	switch d.mode {
+	case base.ReasoningFull:
+		if !d.started && d.color {
+			fmt.Fprint(d.writer, base.ColorGray+base.Italic)
+		}
+		if !d.started {
+			text = strings.TrimLeft(text, " \t\r\n")
+		}
+		fmt.Fprint(d.writer, text)
+	case base.ReasoningCollapsed:
+		if d.color {
+			fmt.Fprintf(d.writer, "\r\033[K%s%sthinking... (%d words)%s", base.ColorGray, base.Italic, d.size, base.ColorReset)
+		} else {
+			fmt.Fprintf(d.writer, "\r\033[Kthinking... (%d words)", d.size)
+		}
+	default:
+		return
+	}
+	d.started = true
+}
+
+// End finishes the display of the reasoning, once the answer starts.
+func (d *reasoningDisplay) End() {
+	if d.ended {
+		return
+	}
+	d.ended = true
+	if !d.started {
+		return
+	}
+
+	switch d.mode {
+	case base.ReasoningFull:
+		if d.color {
+			fmt.Fprint(d.writer, base.ColorReset)
+		}
+		fmt.Fprint(d.writer, "\n\n")
+	case base.ReasoningCollapsed:
+		fmt.Fprint(d.writer, "\r\033[K")
+	}
+}
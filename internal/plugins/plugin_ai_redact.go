@@ -0,0 +1,32 @@
+package plugins
+
+import (
+	"fmt"
+
+	"github.com/ruandada/aish/internal/base"
+	"github.com/ruandada/aish/internal/redact"
+)
+
+// redactForAI hides the secrets of an output before it is sent to the AI, e.g. the tokens printed by env,
+// and tells the user how many were hidden. The values of the environment variables ignored by .aiignore
+// are withheld too. The user still sees the output as it is.
+func (a *AIPlugin) redactForAI(sce *base.SubCommandExecution, shell *base.Shell, text string) string {
+	text = withholdEnv(shell, text)
+	if base.GetConfig(base.ConfigRedact) == base.RedactOff {
+		return text
+	}
+	text, n := redact.Redact(text, base.GetRedactPatterns())
+	if n == 0 || !sce.Interactive() && base.GetConfig(base.ConfigNarration) == base.NarrationNone {
+		return text
+	}
+
+	notice := fmt.Sprintf("%d secrets redacted from the output sent to AI", n)
+	if n == 1 {
+		notice = "1 secret redacted from the output sent to AI"
+	}
+	if sce.ColorSupported() {
+		notice = base.ColorGray + base.Italic + notice + base.ColorReset
+	}
+	fmt.Fprintln(sce.UserStderr(), notice)
+	return text
+}
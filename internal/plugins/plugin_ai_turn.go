@@ -0,0 +1,146 @@
+package plugins
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/ruandada/aish/internal/base"
+)
+
+// aiTurn holds the state of a single question answered by the AI, including the tool calls made for it.
+type aiTurn struct {
+	ce    *base.CommandExecution
+	sce   *base.SubCommandExecution
+	shell *base.Shell
+	qa    *base.AIExecution
+
+	iterLimit       int
+	tools           []openai.ChatCompletionToolParam
+	responseFormat  openai.ChatCompletionNewParamsResponseFormatUnion
+	reasoningEffort string
+
+	// system messages appended after the system prompt
+	instructions []string
+	// messages appended after the question and its answers
+	extra []openai.ChatCompletionMessageParamUnion
+
+	// keep everything but the final answer away from stdout
+	quiet bool
+	// return the final answer to the caller instead of printing it
+	holdAnswer bool
+
+	// what the current tool call evaluated, how it was approved and its risk, for the audit log
+	toolCode     string
+	toolApproval string
+	toolRisk     riskLevel
+	// the timeout of the code of the current tool call, the tool_timeout config if zero
+	toolTimeout time.Duration
+	// the tool whose output looked like instructions to the AI, which raises the risk of the next tool calls
+	// of the turn, of its parent if it is delegated, and of the next turns while the output is in the history,
+	// until the user approves one
+	suspiciousTool string
+}
+
+func (a *AIPlugin) newTurn(ce *base.CommandExecution, sce *base.SubCommandExecution, shell *base.Shell, qa *base.AIExecution) *aiTurn {
+	t := &aiTurn{
+		ce:              ce,
+		sce:             sce,
+		shell:           shell,
+		qa:              qa,
+		iterLimit:       a.iterationLimit(),
+		tools:           a.retrieveToolDefinitions(),
+		reasoningEffort: base.GetConfig(base.ConfigReasoningEffort),
+	}
+	t.suspiciousTool = a.historySuspiciousTool(t)
+	return t
+}
+
+// hasTool reports whether the tool is given to the AI in this turn.
+func (t *aiTurn) hasTool(name string) bool {
+	for _, tool := range t.tools {
+		if tool.Function.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// live reports whether the answer is streamed to the terminal while it is generated.
+func (t *aiTurn) live() bool {
+	return t.sce.Interactive() && !t.quiet
+}
+
+// aiQuestionOptions are the options given before a question, e.g. "ai: --json <question>".
+type aiQuestionOptions struct {
+	json            bool
+	schema          string
+	reasoningEffort string
+	images          stringListValue
+}
+
+// stringListValue is a flag.Value collecting the values of a repeated flag.
+type stringListValue []string
+
+func (v *stringListValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *stringListValue) Set(value string) error {
+	*v = append(*v, value)
+	return nil
+}
+
+// parseQuestionOptions parses the leading options of the question, and updates the question with the rest of the fields.
+func (a *AIPlugin) parseQuestionOptions(sce *base.SubCommandExecution) (*aiQuestionOptions, error) {
+	opts := &aiQuestionOptions{}
+	fields := sce.Fields()
+
+	// a raw question is a single field, which is not parsed for options even if it starts with "-"
+	if sce.QA().IsRoot() && len(fields) > 0 && strings.HasPrefix(fields[0], "-") && !strings.ContainsRune(fields[0], ' ') {
+		commandLine := flag.NewFlagSet(string(ExtensionCommandAIMode), flag.ContinueOnError)
+		commandLine.SetOutput(sce.Stderr())
+		commandLine.Usage = func() {
+			fmt.Fprint(commandLine.Output(), "Usage:\n  ai: [options] <question>\n\n")
+			commandLine.PrintDefaults()
+		}
+		commandLine.BoolVar(&opts.json, "json", false, "answer with a JSON document only")
+		commandLine.StringVar(&opts.schema, "schema", "", "JSON schema file the answer must conform to, implies -json")
+		commandLine.StringVar(&opts.reasoningEffort, "effort", "", "reasoning effort of reasoning models: low, medium or high")
+		commandLine.Var(&opts.images, "image", "image file to attach to the question, can be repeated")
+
+		if err := commandLine.Parse(fields); err != nil {
+			return nil, err
+		}
+		if fields = commandLine.Args(); len(fields) == 0 {
+			commandLine.Usage()
+			return nil, flag.ErrHelp
+		}
+		opts.json = opts.json || opts.schema != ""
+		sce.SetFields(fields)
+	}
+
+	sce.QA().Question = strings.TrimSpace(strings.Join(fields, " "))
+	return opts, nil
+}
+
+// attachImages attaches the images queued by "aiattach" and given by "--image" to the question.
+func (a *AIPlugin) attachImages(t *aiTurn, files []string) error {
+	attachments := make([]*base.AIAttachment, 0, len(files))
+	for _, file := range files {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(t.shell.Dir(), file)
+		}
+		attachment, err := base.LoadImageAttachment(file)
+		if err != nil {
+			return err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	t.qa.Attachments = append(append(t.qa.Attachments, base.TakePendingAttachments()...), attachments...)
+	return nil
+}
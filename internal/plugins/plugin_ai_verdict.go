@@ -0,0 +1,126 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+	"github.com/ruandada/aish/internal/base"
+	"mvdan.cc/sh/v3/interp"
+)
+
+type AIVerdict string
+
+const (
+	AIVerdictTrue    AIVerdict = "true"
+	AIVerdictFalse   AIVerdict = "false"
+	AIVerdictUnknown AIVerdict = "unknown"
+)
+
+type AIVerdictAnswer struct {
+	Verdict AIVerdict `json:"verdict"`
+	Reason  string    `json:"reason"`
+}
+
+var verdictSchema = base.JSONSchema{
+	"type": "object",
+	"properties": map[string]any{
+		"verdict": map[string]any{
+			"type": "string",
+			"enum": []any{string(AIVerdictTrue), string(AIVerdictFalse), string(AIVerdictUnknown)},
+		},
+		"reason": map[string]any{
+			"type": "string",
+		},
+	},
+	"required":             []any{"verdict", "reason"},
+	"additionalProperties": false,
+}
+
+// executeTest answers a yes/no question with the tool-enabled AI loop, and maps the verdict to the exit status:
+// 0 for true, 1 for false and 2 for unknown.
+func (a *AIPlugin) executeTest(ce *base.CommandExecution, sce *base.SubCommandExecution, shell *base.Shell) error {
+	question := strings.TrimSpace(strings.Join(sce.Fields()[1:], " "))
+	if question == "" {
+		fmt.Fprint(sce.Stderr(), "Usage:\n  aitest \"<yes/no question>\"\n\n")
+		return interp.ExitStatus(2)
+	}
+
+	qa := sce.QA()
+	qa.Question = question
+
+	t := a.newTurn(ce, sce, shell, qa)
+	a.startQuestion(t)
+	t.quiet = true
+	t.holdAnswer = true
+	t.instructions = append(t.instructions, "The user asks a yes/no question, investigate it with the tools if needed before answering.")
+
+	answer, err := a.runTurn(t)
+	if err != nil {
+		return a.verdictError(sce, shell, err)
+	}
+
+	// force a final structured verdict, the data needed is already in the context
+	verdict := *t
+	verdict.tools = nil
+	verdict.iterLimit = 0
+	verdict.responseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+		OfJSONSchema: &shared.ResponseFormatJSONSchemaParam{
+			JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{
+				Name:   "verdict",
+				Schema: map[string]any(verdictSchema),
+				Strict: openai.Bool(true),
+			},
+		},
+	}
+	if answer != "" {
+		verdict.extra = append(verdict.extra, openai.AssistantMessage(answer))
+	}
+	verdict.extra = append(verdict.extra, openai.UserMessage(
+		"Give the final verdict of the question as a JSON document: "+
+			`{"verdict": "true" | "false" | "unknown", "reason": "<one short sentence>"}. `+
+			`Use "unknown" if the question can not be answered with confidence.`,
+	))
+
+	result := AIVerdictAnswer{Verdict: AIVerdictUnknown}
+	if text, err := a.runTurn(&verdict); err != nil {
+		return a.verdictError(sce, shell, err)
+	} else if document, err := a.validateJSONAnswer(text, verdictSchema); err != nil {
+		result.Reason = fmt.Sprintf("invalid verdict: %s", err.Error())
+	} else if err := json.Unmarshal([]byte(document), &result); err != nil {
+		result.Reason = fmt.Sprintf("invalid verdict: %s", err.Error())
+	}
+
+	if answer != "" {
+		sce.Stdai().Write([]byte(answer + "\n"))
+	}
+	fmt.Fprintf(sce.Stdai(), "verdict: %s (%s)\n", result.Verdict, result.Reason)
+	fmt.Fprintf(sce.UserStderr(), "%s: %s\n", result.Verdict, result.Reason)
+
+	switch result.Verdict {
+	case AIVerdictTrue:
+		return nil
+	case AIVerdictFalse:
+		return interp.ExitStatus(1)
+	default:
+		return interp.ExitStatus(2)
+	}
+}
+
+// verdictError reports a question which could not be answered, e.g. without a valid API key, with the status
+// of an unknown verdict, so that no script acts on a verdict which was never given. 130 is kept for interrupts.
+func (a *AIPlugin) verdictError(sce *base.SubCommandExecution, shell *base.Shell, err error) error {
+	if errors.Is(err, base.ErrInterrupted) || errors.Is(err, context.Canceled) {
+		return err
+	}
+	// the exit statuses are reported already, e.g. a missing API key
+	if _, ok := err.(interp.ExitStatus); !ok {
+		shell.PrintError(sce.Stderr(), err)
+	}
+	fmt.Fprintf(sce.UserStderr(), "%s: %s\n", AIVerdictUnknown, "no verdict was given")
+	return interp.ExitStatus(2)
+}
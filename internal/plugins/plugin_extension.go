@@ -20,6 +20,14 @@ const (
 	ExtensionCommandAIPrompt      ExtensionCommandName = "aiprompt"
 	ExtensionCommandAITool        ExtensionCommandName = "aitool"
 	ExtensionCommandHistory       ExtensionCommandName = "history"
+	ExtensionCommandAITest        ExtensionCommandName = "aitest"
+	ExtensionCommandAIAttach      ExtensionCommandName = "aiattach"
+	ExtensionCommandAIMemory      ExtensionCommandName = "aimemory"
+	ExtensionCommandAIMCP         ExtensionCommandName = "aimcp"
+	ExtensionCommandAIContinue    ExtensionCommandName = "aicontinue"
+	ExtensionCommandAIUndo        ExtensionCommandName = "aiundo"
+	ExtensionCommandAIAudit       ExtensionCommandName = "aiaudit"
+	ExtensionCommandAIRedact      ExtensionCommandName = "airedact"
 )
 
 var builtinCommands = []string{
@@ -125,6 +133,36 @@ func (p *ExtensionPlugin) Execute(ce *base.CommandExecution, sce *base.SubComman
 			shell.PrintError(sce.Stderr(), err)
 		}
 		return true, nil
+	case string(ExtensionCommandAIAttach):
+		if err := p.handleAIAttachCommand(sce, cmd, args); err != nil {
+			shell.PrintError(sce.Stderr(), err)
+		}
+		return true, nil
+	case string(ExtensionCommandAIMemory):
+		if err := p.handleAIMemoryCommand(sce, cmd, args); err != nil {
+			shell.PrintError(sce.Stderr(), err)
+		}
+		return true, nil
+	case string(ExtensionCommandAIMCP):
+		if err := p.handleAIMCPCommand(sce, cmd, args); err != nil {
+			shell.PrintError(sce.Stderr(), err)
+		}
+		return true, nil
+	case string(ExtensionCommandAIUndo):
+		if err := p.handleAIUndoCommand(sce, cmd, args); err != nil {
+			shell.PrintError(sce.Stderr(), err)
+		}
+		return true, nil
+	case string(ExtensionCommandAIAudit):
+		if err := p.handleAIAuditCommand(sce, cmd, args); err != nil {
+			shell.PrintError(sce.Stderr(), err)
+		}
+		return true, nil
+	case string(ExtensionCommandAIRedact):
+		if err := p.handleAIRedactCommand(sce, cmd, args); err != nil {
+			shell.PrintError(sce.Stderr(), err)
+		}
+		return true, nil
 	default:
 		return false, nil
 	}
@@ -162,6 +200,14 @@ func (p *ExtensionPlugin) rebuildAutoCompleter() {
 		readline.PcItem(string(ExtensionCommandAIGet), configItems...),
 		readline.PcItem(string(ExtensionCommandAIPrompt), readline.PcItem("clear")),
 		readline.PcItem(string(ExtensionCommandAITool), readline.PcItem("clear")),
+		readline.PcItem(string(ExtensionCommandAITest)),
+		readline.PcItem(string(ExtensionCommandAIContinue)),
+		readline.PcItem(string(ExtensionCommandAIAttach), readline.PcItem("clear")),
+		readline.PcItem(string(ExtensionCommandAIMemory), readline.PcItem("list"), readline.PcItem("add"), readline.PcItem("rm")),
+		readline.PcItem(string(ExtensionCommandAIMCP), readline.PcItem("add"), readline.PcItem("rm"), readline.PcItem("clear")),
+		readline.PcItem(string(ExtensionCommandAIUndo), readline.PcItem("--list")),
+		readline.PcItem(string(ExtensionCommandAIAudit), readline.PcItem("-since"), readline.PcItem("-session"), readline.PcItem("-failed")),
+		readline.PcItem(string(ExtensionCommandAIRedact), readline.PcItem("clear")),
 	}
 
 	for _, cmd := range builtinCommands {
@@ -176,6 +222,8 @@ func (p *ExtensionPlugin) rebuildAutoCompleter() {
 
 	completers := append([]readline.PrefixCompleterInterface{
 		readline.PcItem("ai:"),
+		readline.PcItem("ai::"),
+		readline.PcItem("?"),
 		readline.PcItem("user:", commandCompleters...),
 		readline.PcItem("::", commandCompleters...),
 	}, commandCompleters...)
@@ -0,0 +1,53 @@
+package plugins
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/ruandada/aish/internal/base"
+)
+
+func (p *ExtensionPlugin) handleAIAttachCommand(sce *base.SubCommandExecution, cmd string, args []string) error {
+	commandLine := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	commandLine.SetOutput(sce.Stderr())
+	commandLine.Usage = func() {
+		fmt.Fprint(commandLine.Output(), "Usage:\n  aiattach\n  aiattach <image> [<image> ...]\n  aiattach clear\n\n")
+		commandLine.PrintDefaults()
+	}
+
+	err := commandLine.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	args = commandLine.Args()
+	switch {
+	case len(args) == 0:
+		for _, attachment := range base.GetPendingAttachments() {
+			fmt.Fprintf(sce.Stdout(), "%s [%s]\n", attachment.Name, attachment.MediaType)
+		}
+		return nil
+	case len(args) == 1 && args[0] == "clear":
+		base.ClearPendingAttachments()
+		return nil
+	}
+
+	attachments := make([]*base.AIAttachment, 0, len(args))
+	for _, file := range args {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(p.shell.Dir(), file)
+		}
+		attachment, err := base.LoadImageAttachment(file)
+		if err != nil {
+			return err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	// attach all or nothing
+	for _, attachment := range attachments {
+		base.AddPendingAttachment(attachment)
+	}
+	return nil
+}
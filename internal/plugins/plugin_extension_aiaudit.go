@@ -0,0 +1,136 @@
+package plugins
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ruandada/aish/internal/base"
+)
+
+// the layouts of the times given to aiaudit, besides durations such as "2h" meaning 2 hours ago
+var auditTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+func (p *ExtensionPlugin) handleAIAuditCommand(sce *base.SubCommandExecution, cmd string, args []string) error {
+	commandLine := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	commandLine.SetOutput(sce.Stderr())
+	commandLine.Usage = func() {
+		fmt.Fprint(commandLine.Output(), "Usage:\n  aiaudit [-since <time>] [-until <time>] [-session <id>] [-status <code>] [-failed] [-n <count>] [-json]\n\n")
+		commandLine.PrintDefaults()
+	}
+
+	since, until, session, status := "", "", "", ""
+	failed, asJSON := false, false
+	limit := 20
+	commandLine.StringVar(&since, "since", "", "only the records from this time, e.g. 2h, 2006-01-02 or 2006-01-02 15:04")
+	commandLine.StringVar(&until, "until", "", "only the records before this time")
+	commandLine.StringVar(&session, "session", "", "only the records of this session, \"current\" for this shell")
+	commandLine.StringVar(&status, "status", "", "only the records with this exit status")
+	commandLine.BoolVar(&failed, "failed", false, "only the records with a non-zero exit status")
+	commandLine.IntVar(&limit, "n", limit, "the number of the most recent records, 0 for all")
+	commandLine.BoolVar(&asJSON, "json", false, "print the records as JSON lines")
+
+	if err := commandLine.Parse(args); err != nil {
+		return err
+	}
+	if commandLine.NArg() > 0 {
+		commandLine.Usage()
+		return nil
+	}
+
+	var from, to time.Time
+	var err error
+	if since != "" {
+		if from, err = parseAuditTime(since); err != nil {
+			return err
+		}
+	}
+	if until != "" {
+		if to, err = parseAuditTime(until); err != nil {
+			return err
+		}
+	}
+	if session == "current" {
+		session = p.shell.State().Session()
+	}
+	exitStatus := -1
+	if status != "" {
+		if exitStatus, err = strconv.Atoi(status); err != nil {
+			return fmt.Errorf("%s: invalid exit status", status)
+		}
+	}
+
+	records, err := base.ReadAuditRecords(func(err error) {
+		p.shell.PrintError(sce.Stderr(), err)
+	})
+	if err != nil {
+		return err
+	}
+
+	matched := make([]*base.AuditRecord, 0, len(records))
+	for _, r := range records {
+		switch {
+		case !from.IsZero() && r.Time.Before(from),
+			!to.IsZero() && !r.Time.Before(to),
+			session != "" && r.Session != session,
+			exitStatus >= 0 && r.ExitStatus != exitStatus,
+			failed && r.ExitStatus == 0:
+			continue
+		}
+		matched = append(matched, r)
+	}
+	if limit > 0 && len(matched) > limit {
+		matched = matched[len(matched)-limit:]
+	}
+
+	for _, r := range matched {
+		if asJSON {
+			line, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(sce.Stdout(), string(line))
+			continue
+		}
+
+		call := r.Code
+		if call == "" {
+			call = string(r.Arguments)
+		}
+		call = strings.Join(strings.Fields(call), " ")
+		if len(call) > 120 {
+			call = call[:runeBoundary(call, 120)] + "…"
+		}
+		approval := ""
+		if r.Approval != "" {
+			approval = "  " + r.Approval
+		}
+		if r.Risk == riskHigh.String() {
+			approval += "  high risk"
+		}
+		fmt.Fprintf(sce.Stdout(), "%s  %s  exit %d  %s%s  %s: %s\n",
+			r.Time.Local().Format("2006-01-02 15:04:05"), r.Session, r.ExitStatus,
+			time.Duration(r.DurationMS)*time.Millisecond, approval, r.Tool, call)
+		// the tool calls of MCP clients have no question
+		if r.Question != "" {
+			fmt.Fprintf(sce.Stdout(), "  %s\n", r.Question)
+		}
+	}
+	return nil
+}
+
+// parseAuditTime parses a time given to aiaudit, a duration means this long ago.
+func parseAuditTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range auditTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%s: invalid time, e.g. 2h, 2006-01-02 or 2006-01-02 15:04", value)
+}
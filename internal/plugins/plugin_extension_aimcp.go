@@ -0,0 +1,64 @@
+package plugins
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ruandada/aish/internal/base"
+)
+
+func (p *ExtensionPlugin) handleAIMCPCommand(sce *base.SubCommandExecution, cmd string, args []string) error {
+	commandLine := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	commandLine.SetOutput(sce.Stderr())
+	commandLine.Usage = func() {
+		fmt.Fprint(commandLine.Output(), "Usage:\n  aimcp\n  aimcp add <name> -- <command> [<arg> ...]\n  aimcp rm <name>\n  aimcp clear\n\n")
+		commandLine.PrintDefaults()
+	}
+
+	err := commandLine.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	args = commandLine.Args()
+	if len(args) == 0 {
+		for _, client := range base.GetMCPServers() {
+			fmt.Fprintf(sce.Stdout(), "%s: %s\n", client.Name(), strings.Join(client.Command(), " "))
+			for _, tool := range client.Tools() {
+				fmt.Fprintf(sce.Stdout(), "  tool %s\n", tool.Name)
+			}
+			for _, resource := range client.Resources() {
+				fmt.Fprintf(sce.Stdout(), "  resource %s [%s]\n", resource.URI, resource.Name)
+			}
+		}
+		return nil
+	}
+
+	switch action, args := args[0], args[1:]; action {
+	case "add":
+		if len(args) > 1 && args[1] == "--" {
+			args = append(args[:1], args[2:]...)
+		}
+		if len(args) < 2 {
+			commandLine.Usage()
+			return nil
+		}
+		return base.AddMCPServer(sce.Context(), args[0], args[1:], p.shell.Dir(), p.shell.Environ())
+
+	case "rm":
+		if len(args) != 1 {
+			commandLine.Usage()
+			return nil
+		}
+		return base.RemoveMCPServer(args[0])
+
+	case "clear":
+		base.ClearMCPServers()
+		return nil
+
+	default:
+		commandLine.Usage()
+		return nil
+	}
+}
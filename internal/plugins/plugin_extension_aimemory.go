@@ -0,0 +1,101 @@
+package plugins
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ruandada/aish/internal/base"
+)
+
+func (p *ExtensionPlugin) handleAIMemoryCommand(sce *base.SubCommandExecution, cmd string, args []string) error {
+	commandLine := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	commandLine.SetOutput(sce.Stderr())
+	commandLine.Usage = func() {
+		fmt.Fprint(commandLine.Output(), "Usage:\n  aimemory [list] [-a]\n  aimemory add [-w] [-t <tag,...>] <content>\n  aimemory rm <id> [<id> ...]\n\n")
+		commandLine.PrintDefaults()
+	}
+
+	all := false
+	workspace := false
+	tags := ""
+	commandLine.BoolVar(&all, "a", false, "list the memories of all workspaces")
+	commandLine.BoolVar(&workspace, "w", false, "only remember in the current workspace")
+	commandLine.StringVar(&tags, "t", "", "comma separated tags")
+
+	action := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+
+	if err := commandLine.Parse(args); err != nil {
+		return err
+	}
+	args = commandLine.Args()
+
+	store, err := base.GetMemoryStore()
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "list":
+		dir := p.shell.Dir()
+		if all {
+			dir = ""
+		}
+		for _, memory := range store.List(dir) {
+			scope := string(memory.Scope)
+			if memory.Scope == base.MemoryScopeWorkspace {
+				scope = memory.Workspace
+			}
+			fmt.Fprintf(sce.Stdout(), "%s  %s  %s", memory.ID, memory.CreatedAt.Format("2006-01-02"), scope)
+			if len(memory.Tags) > 0 {
+				fmt.Fprintf(sce.Stdout(), "  [%s]", strings.Join(memory.Tags, ","))
+			}
+			fmt.Fprintf(sce.Stdout(), "\n  %s\n", memory.Content)
+		}
+		return nil
+
+	case "add":
+		if len(args) == 0 {
+			commandLine.Usage()
+			return nil
+		}
+		scope := base.MemoryScopeGlobal
+		if workspace {
+			scope = base.MemoryScopeWorkspace
+		}
+		var tagList []string
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tagList = append(tagList, tag)
+			}
+		}
+
+		memory, err := store.Add(strings.Join(args, " "), scope, p.shell.Dir(), tagList)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(sce.Stdout(), memory.ID)
+		return nil
+
+	case "rm":
+		if len(args) == 0 {
+			commandLine.Usage()
+			return nil
+		}
+		for _, id := range args {
+			if ok, err := store.Remove(id); err != nil {
+				return err
+			} else if !ok {
+				return fmt.Errorf("%s: memory not found", id)
+			}
+		}
+		return nil
+
+	default:
+		commandLine.Usage()
+		return nil
+	}
+}
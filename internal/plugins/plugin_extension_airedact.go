@@ -0,0 +1,45 @@
+package plugins
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/ruandada/aish/internal/base"
+	"github.com/ruandada/aish/internal/redact"
+)
+
+func (p *ExtensionPlugin) handleAIRedactCommand(sce *base.SubCommandExecution, cmd string, args []string) error {
+	commandLine := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	commandLine.SetOutput(sce.Stderr())
+	commandLine.Usage = func() {
+		fmt.Fprint(commandLine.Output(), "Usage:\n  airedact\n  airedact \"<regexp>\" ...\n  airedact -t \"<text>\"\n  airedact clear\n\n")
+		commandLine.PrintDefaults()
+	}
+
+	text := ""
+	commandLine.StringVar(&text, "t", "", "print the text as it is sent to AI, with its secrets redacted")
+
+	if err := commandLine.Parse(args); err != nil {
+		return err
+	}
+	args = commandLine.Args()
+
+	switch {
+	case text != "":
+		redacted, n := redact.Redact(text, base.GetRedactPatterns())
+		fmt.Fprintf(sce.UserStdout(), "%s\n[%d redacted]\n", redacted, n)
+	case len(args) == 0:
+		for _, re := range base.GetRedactPatterns() {
+			fmt.Fprintln(sce.Stdout(), re.String())
+		}
+	case len(args) == 1 && args[0] == "clear":
+		base.ClearRedactPatterns()
+	default:
+		for _, pattern := range args {
+			if err := base.AddRedactPattern(pattern); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -26,8 +26,11 @@ func (p *ExtensionPlugin) handleAISetCommand(sce *base.SubCommandExecution, cmd
 		return nil
 	}
 
-	key := args[0]
+	key := base.ConfigName(args[0])
 	value := args[1]
-	base.SetConfig(base.ConfigName(key), value)
+	if err := base.ValidateConfig(key, value); err != nil {
+		return err
+	}
+	base.SetConfig(key, value)
 	return nil
 }
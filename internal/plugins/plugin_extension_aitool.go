@@ -3,6 +3,7 @@ package plugins
 import (
 	"flag"
 	"fmt"
+	"path/filepath"
 
 	"github.com/ruandada/aish/internal/base"
 )
@@ -11,7 +12,7 @@ func (p *ExtensionPlugin) handleAIToolCommand(sce *base.SubCommandExecution, cmd
 	commandLine := flag.NewFlagSet(cmd, flag.ContinueOnError)
 	commandLine.SetOutput(sce.Stderr())
 	commandLine.Usage = func() {
-		fmt.Fprint(commandLine.Output(), "Usage:\n  aitool -u \"<usage>\" <entrypoint>\n  aitool clear\n\n")
+		fmt.Fprint(commandLine.Output(), "Usage:\n  aitool -u \"<usage>\" <entrypoint>\n  aitool load <manifest>...\n  aitool clear\n\n")
 		commandLine.PrintDefaults()
 	}
 
@@ -24,11 +25,36 @@ func (p *ExtensionPlugin) handleAIToolCommand(sce *base.SubCommandExecution, cmd
 	}
 
 	args = commandLine.Args()
+	if len(args) > 0 && args[0] == "load" {
+		if len(args) == 1 {
+			commandLine.Usage()
+			return nil
+		}
+		for _, file := range args[1:] {
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(p.shell.Dir(), file)
+			}
+			manifest, err := base.LoadToolManifest(file, p.shell.Getenv("PATH"))
+			if err != nil {
+				return err
+			}
+			if err := base.AddManifestTool(manifest); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	switch len(args) {
 	case 0:
 		sce.Stdout().Write([]byte("AI tools:\n\n"))
 		tools := base.GetDefinedTools()
 		for _, tool := range tools {
+			if tool.Manifest != nil {
+				fmt.Fprintf(sce.Stdout(), "%s\n[name=%s] [manifest=%s] [risk=%s]\n[usage=%s]\n\n",
+					tool.Entrypoint, tool.Name, tool.Manifest.File, tool.Manifest.Risk, tool.Usage)
+				continue
+			}
 			fmt.Fprintf(sce.Stdout(), "%s\n[usage=%s]\n\n", tool.Entrypoint, tool.Usage)
 		}
 		return nil
@@ -39,17 +65,17 @@ func (p *ExtensionPlugin) handleAIToolCommand(sce *base.SubCommandExecution, cmd
 			return nil
 		}
 
-		filepath, err := p.shell.LookPath(entrypoint)
+		path, err := p.shell.LookPath(entrypoint)
 		if err != nil {
 			return err
 		}
 
-		if filepath == p.shell.AbsoluteFileName() {
+		if path == p.shell.AbsoluteFileName() {
 			// currently is running tool file, skip
 			return nil
 		}
 
-		if err := base.AddDefinedTool(usage, filepath); err != nil {
+		if err := base.AddDefinedTool(usage, path); err != nil {
 			return err
 		}
 	default:
@@ -0,0 +1,120 @@
+package plugins
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/ruandada/aish/internal/base"
+)
+
+func (p *ExtensionPlugin) handleAIUndoCommand(sce *base.SubCommandExecution, cmd string, args []string) error {
+	commandLine := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	commandLine.SetOutput(sce.Stderr())
+	commandLine.Usage = func() {
+		fmt.Fprint(commandLine.Output(), "Usage:\n  aiundo [-f] [<turn>]\n  aiundo --list\n\n")
+		commandLine.PrintDefaults()
+	}
+
+	list := false
+	verbose := false
+	force := false
+	commandLine.BoolVar(&list, "list", false, "list the turns which changed files, the most recent last")
+	commandLine.BoolVar(&verbose, "v", false, "list the files changed by each turn")
+	commandLine.BoolVar(&force, "f", false, "restore the files even if they changed since the turn")
+
+	if err := commandLine.Parse(args); err != nil {
+		return err
+	}
+	args = commandLine.Args()
+
+	store, err := base.GetCheckpointStore()
+	if err != nil {
+		return err
+	}
+	checkpoints, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	if list {
+		for _, checkpoint := range checkpoints {
+			state := ""
+			if checkpoint.Undone {
+				state = "  (undone)"
+			}
+			fmt.Fprintf(sce.Stdout(), "%d  %s  %s  %d files%s\n  %s\n", checkpoint.ID, checkpoint.CreatedAt.Format("2006-01-02 15:04"),
+				checkpoint.Dir, len(checkpoint.Files), state, checkpoint.Question)
+			if verbose {
+				for _, file := range checkpoint.Files {
+					fmt.Fprintf(sce.Stdout(), "    %s\n", file.Path)
+				}
+			}
+		}
+		return nil
+	}
+
+	var checkpoint *base.Checkpoint
+	switch len(args) {
+	case 0:
+		// the most recent turn which is not undone yet
+		for i := len(checkpoints) - 1; i >= 0 && checkpoint == nil; i-- {
+			if !checkpoints[i].Undone {
+				checkpoint = checkpoints[i]
+			}
+		}
+		if checkpoint == nil {
+			return fmt.Errorf("nothing to undo")
+		}
+	case 1:
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			commandLine.Usage()
+			return nil
+		}
+		if checkpoint, err = store.Get(id); err != nil {
+			return err
+		}
+		if checkpoint.Undone {
+			return fmt.Errorf("%d: turn already undone", id)
+		}
+	default:
+		commandLine.Usage()
+		return nil
+	}
+
+	if !force {
+		overlaps := checkpoint.Overlaps(checkpoints)
+		for _, file := range overlaps {
+			fmt.Fprintf(sce.Stderr(), "changed by a more recent turn: %s\n", file)
+		}
+		modified := 0
+		for _, file := range checkpoint.Modified() {
+			if !slices.Contains(overlaps, file) {
+				fmt.Fprintf(sce.Stderr(), "changed since the turn: %s\n", file)
+				modified++
+			}
+		}
+		if len(overlaps)+modified > 0 {
+			return fmt.Errorf("%d: the changes made to the files since the turn would be lost, use -f to restore them anyway", checkpoint.ID)
+		}
+	}
+
+	restored, err := checkpoint.Restore()
+	for _, file := range restored {
+		if file.Existed {
+			fmt.Fprintf(sce.Stdout(), "restored %s\n", file.Path)
+		} else {
+			fmt.Fprintf(sce.Stdout(), "removed %s\n", file.Path)
+		}
+	}
+	for _, file := range checkpoint.Skipped {
+		fmt.Fprintf(sce.Stderr(), "not restored, too large to be saved: %s\n", file)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(sce.Stdout(), "undone turn %d: %s\n", checkpoint.ID, checkpoint.Question)
+	return nil
+}
@@ -0,0 +1,66 @@
+package redact
+
+import "testing"
+
+func TestRedactSensitiveNames(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		// secrets
+		{`API_KEY=abc123def456`, `API_KEY=[REDACTED]`},
+		{`export GITHUB_TOKEN=hunter2`, `export GITHUB_TOKEN=[REDACTED]`},
+		{`password: hunter2`, `password: [REDACTED]`},
+		{`"password": "hunter2"`, `"password": "[REDACTED]"`},
+		{`db_password = 'hunter2'`, `db_password = '[REDACTED]'`},
+		{`token := "hunter2"`, `token := "[REDACTED]"`},
+
+		// not secrets
+		{`token: $TOKEN`, `token: $TOKEN`},
+		{`password: null`, `password: null`},
+		{`password: ****`, `password: ****`},
+		{`if token == nil {`, `if token == nil {`},
+		{`if (token === undefined) {`, `if (token === undefined) {`},
+		{`if token != "" {`, `if token != "" {`},
+		{`token := r.Header.Get("X")`, `token := r.Header.Get("X")`},
+		{`token := t`, `token := t`},
+		{`api_key = os.environ['API_KEY']`, `api_key = os.environ['API_KEY']`},
+		{`password = getpass()`, `password = getpass()`},
+		{`self.token = token`, `self.token = token`},
+		{`secret: config.secret,`, `secret: config.secret,`},
+	}
+
+	for _, test := range tests {
+		if got, _ := Redact(test.text, nil); got != test.want {
+			t.Errorf("Redact(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestRedactRandomStrings(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		// secrets
+		{`q8Zr3Xk9LmP2vT7wYb4NcH6d`, `[REDACTED]`},
+		{`auth: dGhpcyBpcyBhIHNlY3JldCB0b2tlbiAx`, `auth: [REDACTED]`},
+		{`Zm9vYmFyYmF6cXV4MTIzNDU2Nzg5MGFiY2RlZg==`, `[REDACTED]`},
+
+		// not secrets
+		{`/Users/JohnSmith/Projects/MyApp2024/src/main.go`, `/Users/JohnSmith/Projects/MyApp2024/src/main.go`},
+		{`internal/plugins/plugin_ai_checkpoint_test.go:42`, `internal/plugins/plugin_ai_checkpoint_test.go:42`},
+		{`func ExampleHandlerFunc_ServeHTTP_withContext2(t *testing.T)`, `func ExampleHandlerFunc_ServeHTTP_withContext2(t *testing.T)`},
+		{`TestParseHunkHeader_NoNewlineAtEndOfFile2`, `TestParseHunkHeader_NoNewlineAtEndOfFile2`},
+		{`2024-06-01T12:00:00Z INFO requestLoggingMiddleware2Handler served GET /api/v1/users in 12ms`,
+			`2024-06-01T12:00:00Z INFO requestLoggingMiddleware2Handler served GET /api/v1/users in 12ms`},
+		{`com.example.MyApplication$ServiceConnectionHandler3.run(MyApplication.java:120)`,
+			`com.example.MyApplication$ServiceConnectionHandler3.run(MyApplication.java:120)`},
+	}
+
+	for _, test := range tests {
+		if got, _ := Redact(test.text, nil); got != test.want {
+			t.Errorf("Redact(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
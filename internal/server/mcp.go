@@ -0,0 +1,208 @@
+// Package server exposes a shell to other programs, as an MCP server or as a JSON-RPC server.
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ruandada/aish/internal/base"
+	"github.com/ruandada/aish/internal/mcp"
+	"github.com/ruandada/aish/internal/plugins"
+)
+
+const (
+	ResourceCwd     = "aish://cwd"
+	ResourceHistory = "aish://history"
+)
+
+// ServeMCP serves the shell to an MCP client: an execute tool evaluating command lines, the tools
+// registered with aitool, and the working directory and the history as resources.
+func ServeMCP(ctx context.Context, shell *base.Shell, ai *plugins.AIPlugin, reader io.Reader, writer io.Writer) error {
+	s := mcp.NewServer(base.DefaultFileName, "1.0.0")
+
+	s.AddTool(mcp.Tool{
+		Name: "execute",
+		Description: "Execute a command line in aish, a POSIX shell with an AI assistant, " +
+			"questions can be asked to the assistant with: ai: <question>",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"code": map[string]any{
+					"type":        "string",
+					"description": "The command line to execute",
+				},
+			},
+			"required": []string{"code"},
+		},
+	}, func(ctx context.Context, arguments map[string]any) (*mcp.CallToolResult, error) {
+		code, _ := arguments["code"].(string)
+		return execute(ctx, shell, "execute", arguments, code)
+	})
+
+	tools := base.GetDefinedTools()
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		tool := tools[name]
+		// the high risk tools need the approval of the user, who can't be asked over MCP
+		if tool.Manifest != nil && tool.Manifest.Risk == base.ToolRiskHigh {
+			continue
+		}
+		if tool.Manifest != nil {
+			s.AddTool(mcp.Tool{
+				Name:        tool.Name,
+				Description: tool.Manifest.Description,
+				InputSchema: tool.Manifest.Parameters,
+			}, func(ctx context.Context, arguments map[string]any) (*mcp.CallToolResult, error) {
+				invocation, err := tool.Manifest.Invocation(arguments)
+				if err != nil {
+					return nil, fmt.Errorf("%s: invalid arguments: %w", tool.Name, err)
+				}
+				code, err := invocation.CommandLine()
+				if err != nil {
+					return nil, err
+				}
+				if timeout := time.Duration(tool.Manifest.Timeout); timeout > 0 {
+					var cancel context.CancelFunc
+					// the command line is stopped as a whole, with the exit status 124
+					ctx, cancel = context.WithTimeoutCause(ctx, timeout, &base.LimitError{Timeout: timeout})
+					defer cancel()
+				}
+				return execute(ctx, shell, tool.Name, arguments, code)
+			})
+			continue
+		}
+
+		usage := "none"
+		if tool.Usage != "" {
+			usage = tool.Usage
+		}
+
+		s.AddTool(mcp.Tool{
+			Name:        tool.Name,
+			Description: fmt.Sprintf("Execute %s, usage: %s", tool.Entrypoint, usage),
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"args": map[string]any{
+						"type":  "array",
+						"items": map[string]any{"type": "string"},
+					},
+				},
+			},
+		}, func(ctx context.Context, arguments map[string]any) (*mcp.CallToolResult, error) {
+			fields := []string{tool.Entrypoint}
+			if args, ok := arguments["args"].([]any); ok {
+				for _, arg := range args {
+					fields = append(fields, fmt.Sprint(arg))
+				}
+			}
+			code, err := base.CombineFields(fields)
+			if err != nil {
+				return nil, err
+			}
+			return execute(ctx, shell, tool.Name, arguments, code)
+		})
+	}
+
+	s.AddResource(mcp.Resource{
+		URI:         ResourceCwd,
+		Name:        "working directory",
+		Description: "The working directory of the shell",
+		MimeType:    "text/plain",
+	}, func(ctx context.Context) (*mcp.ResourceContents, error) {
+		return &mcp.ResourceContents{URI: ResourceCwd, MimeType: "text/plain", Text: shell.Dir()}, nil
+	})
+
+	s.AddResource(mcp.Resource{
+		URI:         ResourceHistory,
+		Name:        "history",
+		Description: "The recent command lines and questions with their answers",
+		MimeType:    "application/json",
+	}, func(ctx context.Context) (*mcp.ResourceContents, error) {
+		b, err := json.Marshal(ai.History())
+		if err != nil {
+			return nil, err
+		}
+		return &mcp.ResourceContents{URI: ResourceHistory, MimeType: "application/json", Text: string(b)}, nil
+	})
+
+	return s.Serve(ctx, reader, writer)
+}
+
+// execute evaluates the code of a tool call, which is written to the audit log like the tool calls of the AI.
+func execute(ctx context.Context, shell *base.Shell, tool string, arguments map[string]any, code string) (*mcp.CallToolResult, error) {
+	started := time.Now()
+	output := &syncBuffer{}
+	ce, err := shell.Exec(ctx, code, output, output)
+	if err != nil {
+		audit(shell, tool, arguments, code, started, "", base.ExitStatusOf(err), err)
+		return nil, err
+	}
+
+	text := output.String()
+	audit(shell, tool, arguments, code, started, text, ce.ExitStatus(), nil)
+	if status := ce.ExitStatus(); status != 0 {
+		text += fmt.Sprintf("\nExit status: %d", status)
+		return &mcp.CallToolResult{Content: []mcp.Content{mcp.TextContent(text)}, IsError: true}, nil
+	}
+	return &mcp.CallToolResult{Content: []mcp.Content{mcp.TextContent(text)}}, nil
+}
+
+// audit writes a tool call of the MCP client to the audit log, it has no question.
+func audit(shell *base.Shell, tool string, arguments map[string]any, code string, started time.Time, output string, status int, err error) {
+	args, _ := json.Marshal(arguments)
+	hash := sha256.Sum256([]byte(output))
+
+	record := &base.AuditRecord{
+		Time:         started,
+		Session:      shell.State().Session(),
+		User:         shell.State().User().Username,
+		Dir:          shell.Dir(),
+		Tool:         tool,
+		Arguments:    args,
+		Code:         code,
+		ExitStatus:   status,
+		DurationMS:   time.Since(started).Milliseconds(),
+		OutputSize:   len(output),
+		OutputSHA256: hex.EncodeToString(hash[:]),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if err := base.AppendAuditRecord(record); err != nil {
+		// stdout is the MCP connection
+		shell.PrintError(os.Stderr, fmt.Errorf("audit log: %w", err))
+	}
+}
+
+// syncBuffer is a buffer which can be written by the commands of a pipeline at the same time.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ruandada/aish/internal/base"
+	"github.com/ruandada/aish/internal/jsonrpc"
+	"github.com/ruandada/aish/internal/plugins"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Methods of the headless server
+const (
+	MethodEval      = "eval"
+	MethodAsk       = "ask"
+	MethodSetMode   = "setMode"
+	MethodGetConfig = "getConfig"
+	MethodCancel    = "cancel"
+)
+
+// Notifications sent to the client while a command line is evaluated
+const (
+	NotificationOutput = "output"
+	NotificationEvent  = "event"
+)
+
+type EvalParams struct {
+	Code string `json:"code"`
+}
+
+type AskParams struct {
+	Question string `json:"question"`
+}
+
+type EvalResult struct {
+	Status int                 `json:"status"`
+	Trace  []*base.AIExecution `json:"trace"`
+}
+
+type SetModeParams struct {
+	Mode string `json:"mode"`
+}
+
+type GetConfigParams struct {
+	Name string `json:"name,omitempty"`
+}
+
+type CancelParams struct {
+	// the id of the eval or ask request to cancel
+	Request json.RawMessage `json:"request"`
+}
+
+type CancelResult struct {
+	Cancelled bool `json:"cancelled"`
+}
+
+// OutputNotification carries the output of the command line evaluated for a request.
+type OutputNotification struct {
+	Request json.RawMessage `json:"request"`
+	Stream  string          `json:"stream"`
+	Data    string          `json:"data"`
+}
+
+// EventNotification carries an event of the command line evaluated for a request, e.g. a token generated by the AI.
+type EventNotification struct {
+	Request json.RawMessage `json:"request"`
+	base.ExecutionEvent
+}
+
+var shellModes = map[string]base.ShellMode{
+	"auto": base.ShellModeAuto,
+	"user": base.ShellModeUser,
+	"ai":   base.ShellModeAI,
+}
+
+// Serve serves the shell to JSON-RPC clients at the address, which is "stdio" or "unix:<path>".
+// The command lines of all clients are evaluated one at a time by the same shell.
+func Serve(ctx context.Context, shell *base.Shell, address string) error {
+	if address == "stdio" {
+		return serveConn(ctx, shell, os.Stdin, os.Stdout)
+	}
+
+	path, ok := strings.CutPrefix(address, "unix:")
+	if !ok || path == "" {
+		return fmt.Errorf("%s: unsupported address, use stdio or unix:<path>", address)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			if err := serveConn(ctx, shell, conn, conn); err != nil {
+				shell.PrintError(os.Stderr, err)
+			}
+		}()
+	}
+}
+
+func serveConn(ctx context.Context, shell *base.Shell, reader io.Reader, writer io.Writer) error {
+	// the requests of the client being evaluated, which it can cancel
+	requests := &pendingRequests{cancels: map[string]context.CancelFunc{}}
+
+	return jsonrpc.NewConn(reader, writer, func(ctx context.Context, conn *jsonrpc.Conn, req *jsonrpc.Request) (any, error) {
+		switch req.Method {
+		case MethodEval:
+			params := EvalParams{}
+			if err := req.BindParams(&params); err != nil {
+				return nil, err
+			}
+			return eval(ctx, shell, conn, requests, req.ID, params.Code)
+
+		case MethodAsk:
+			params := AskParams{}
+			if err := req.BindParams(&params); err != nil {
+				return nil, err
+			}
+			question, err := syntax.Quote(params.Question, syntax.LangBash)
+			if err != nil {
+				return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "%s", err.Error())
+			}
+			// the question is not parsed for options
+			return eval(ctx, shell, conn, requests, req.ID, string(plugins.ExtensionCommandAIMode)+" -- "+question)
+
+		case MethodSetMode:
+			params := SetModeParams{}
+			if err := req.BindParams(&params); err != nil {
+				return nil, err
+			}
+			mode, ok := shellModes[params.Mode]
+			if !ok {
+				return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "%s: unknown mode, use auto, user or ai", params.Mode)
+			}
+			shell.State().SetMode(mode)
+			return params, nil
+
+		case MethodGetConfig:
+			params := GetConfigParams{}
+			if err := req.BindParams(&params); err != nil {
+				return nil, err
+			}
+			if params.Name != "" {
+				return map[string]string{params.Name: base.GetConfig(base.ConfigName(params.Name))}, nil
+			}
+			return base.GetAllConfig(), nil
+
+		case MethodCancel:
+			params := CancelParams{}
+			if err := req.BindParams(&params); err != nil {
+				return nil, err
+			}
+			if len(params.Request) == 0 {
+				return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "missing request")
+			}
+			return CancelResult{Cancelled: requests.cancel(params.Request)}, nil
+
+		default:
+			return nil, jsonrpc.NewError(jsonrpc.CodeMethodNotFound, "method not found: %s", req.Method)
+		}
+	}).Run(ctx)
+}
+
+func eval(ctx context.Context, shell *base.Shell, conn *jsonrpc.Conn, requests *pendingRequests, id json.RawMessage, code string) (*EvalResult, error) {
+	ctx, done := requests.add(ctx, id)
+	defer done()
+
+	ctx = base.WithExecutionListener(ctx, func(event base.ExecutionEvent) {
+		conn.Notify(NotificationEvent, EventNotification{Request: id, ExecutionEvent: event})
+	})
+
+	ce, err := shell.Exec(
+		ctx,
+		code,
+		&notificationWriter{conn: conn, request: id, stream: "stdout"},
+		&notificationWriter{conn: conn, request: id, stream: "stderr"},
+	)
+	if err != nil {
+		return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "%s", err.Error())
+	}
+
+	trace := ce.QA()
+	if trace == nil {
+		trace = []*base.AIExecution{}
+	}
+	return &EvalResult{Status: ce.ExitStatus(), Trace: trace}, nil
+}
+
+// pendingRequests are the requests of a client being evaluated, by their id.
+type pendingRequests struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// add returns the context of a request, which is cancelled by cancel until done is called.
+func (r *pendingRequests) add(ctx context.Context, id json.RawMessage) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	key := requestKey(id)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancels[key] = cancel
+	return ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.cancels, key)
+		cancel()
+	}
+}
+
+func (r *pendingRequests) cancel(id json.RawMessage) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cancel, ok := r.cancels[requestKey(id)]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// requestKey returns the id of a request in a canonical form, so that it matches however the client writes it.
+func requestKey(id json.RawMessage) string {
+	var value any
+	if err := json.Unmarshal(id, &value); err != nil {
+		return string(id)
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+// notificationWriter sends the output written to it as notifications.
+type notificationWriter struct {
+	conn    *jsonrpc.Conn
+	request json.RawMessage
+	stream  string
+}
+
+func (w *notificationWriter) Write(p []byte) (int, error) {
+	if err := w.conn.Notify(NotificationOutput, OutputNotification{
+		Request: w.request,
+		Stream:  w.stream,
+		Data:    string(p),
+	}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}